@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/jayzes/memorex/internal/output"
+	"github.com/jayzes/memorex/internal/ui"
+)
+
+// mediaExtensions are the file types picked up when scanning a directory.
+// Files named explicitly on the command line are processed regardless.
+var mediaExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true,
+	".avi": true, ".wmv": true, ".flv": true, ".mpg": true, ".mpeg": true,
+	".mp3": true, ".m4a": true, ".wav": true, ".aac": true, ".flac": true,
+	".ogg": true, ".opus": true,
+}
+
+// batchResult is the outcome of processing one file in a batch
+type batchResult struct {
+	summary  fileSummary
+	warnings []string
+	err      error
+}
+
+// expandInputs resolves files, directories and glob patterns into a
+// de-duplicated list of input files, in argument order
+func expandInputs(args []string) ([]string, error) {
+	var inputs []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		clean := filepath.Clean(path)
+		if !seen[clean] {
+			seen[clean] = true
+			inputs = append(inputs, clean)
+		}
+	}
+
+	for _, arg := range args {
+		// URLs and standard input go straight to ffmpeg
+		if !isLocal(arg) {
+			if !seen[arg] {
+				seen[arg] = true
+				inputs = append(inputs, arg)
+			}
+			continue
+		}
+
+		// A path that exists is taken literally, even if it looks like a
+		// pattern, as with "talk [v2].mp4"
+		paths := []string{arg}
+		if _, err := os.Stat(arg); err != nil && strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, fmt.Errorf("input file does not exist: %s", path)
+			}
+
+			if !info.IsDir() {
+				add(path)
+				continue
+			}
+
+			err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && mediaExtensions[strings.ToLower(filepath.Ext(p))] {
+					add(p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan directory %s: %w", path, err)
+			}
+		}
+	}
+
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no media files found")
+	}
+
+	return inputs, nil
+}
+
+// batchOutputPath returns the output path for one file of a batch. With -o,
+// outputs go into that directory; otherwise next to each input.
+func batchOutputPath(inputPath string) string {
+	path := defaultOutputPath(inputPath)
+	if outputPath == "" {
+		return path
+	}
+	return filepath.Join(outputPath, filepath.Base(path))
+}
+
+// runBatch processes several files with a bounded worker pool and prints an
+// aggregate summary
+func runBatch(inputs []string) error {
+	jobList := make([]*job, len(inputs))
+	owners := make(map[string]string)
+	for i, input := range inputs {
+		path := batchOutputPath(input)
+		if other, ok := owners[path]; ok {
+			return fmt.Errorf("%s and %s would both write %s", other, input, path)
+		}
+		owners[path] = input
+		jobList[i] = &job{inputPath: input, outputPath: path, quiet: true}
+	}
+
+	if outputPath != "" {
+		if err := os.MkdirAll(outputPath, 0o750); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	workers := min(jobs, len(jobList))
+
+	ui.PrintHeader("memorex")
+	ui.PrintInfo(fmt.Sprintf("Processing %d files (%d at a time)", len(jobList), workers))
+	fmt.Fprintln(os.Stderr)
+
+	// Download the model once up front so workers don't race to fetch it
+	if !noTranscript {
+		if err := (&job{}).ensureModel(modelPath); err != nil {
+			return err
+		}
+	}
+
+	results := make([]batchResult, len(jobList))
+	step := ui.NewStep(fmt.Sprintf("Processing %d files", len(jobList)))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		finished int
+	)
+	queue := make(chan int)
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				j := jobList[i]
+				summary, err := processFile(j)
+				results[i] = batchResult{summary: summary, warnings: j.warnings, err: err}
+
+				name := output.InputName(j.inputPath)
+				if err != nil {
+					step.Println(ui.ErrorLine(fmt.Sprintf("%s: %v", name, err)))
+				} else {
+					step.Println(ui.SuccessLine(fmt.Sprintf("%s → %s", name, j.outputPath)))
+				}
+
+				mu.Lock()
+				finished++
+				step.Update(float64(finished) / float64(len(jobList)))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range jobList {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+	step.Complete(fmt.Sprintf("Processed %d files (%d failed)", len(jobList), failed))
+
+	fmt.Fprintln(os.Stderr)
+	printBatchSummary(results)
+
+	if indexPath != "" {
+		if err := output.WriteIndex(indexPath, indexEntries(results)); err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+		fmt.Fprintln(os.Stderr)
+		ui.PrintSuccess(fmt.Sprintf("Index: %s", indexPath))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(jobList))
+	}
+	return nil
+}
+
+// printBatchSummary prints a table with one row per file plus totals,
+// followed by any warnings collected while processing
+func printBatchSummary(results []batchResult) {
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FILE\tDURATION\tKEYFRAMES\tSEGMENTS\tTOKENS\tSTATUS")
+
+	var total fileSummary
+	failed := 0
+	for _, r := range results {
+		name := output.InputName(r.summary.inputPath)
+		if r.err != nil {
+			failed++
+			_, _ = fmt.Fprintf(tw, "%s\t-\t-\t-\t-\tfailed\n", name)
+			continue
+		}
+
+		s := r.summary
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t~%d\tok\n",
+			name, formatDuration(s.duration), s.keyframes, s.segments, s.tokens)
+
+		total.duration += s.duration
+		total.keyframes += s.keyframes
+		total.segments += s.segments
+		total.tokens += s.tokens
+	}
+
+	_, _ = fmt.Fprintf(tw, "TOTAL\t%s\t%d\t%d\t~%d\t%d failed\n",
+		formatDuration(total.duration), total.keyframes, total.segments, total.tokens, failed)
+	_ = tw.Flush()
+
+	for _, r := range results {
+		for _, w := range r.warnings {
+			ui.PrintWarning(fmt.Sprintf("%s: %s", output.InputName(r.summary.inputPath), w))
+		}
+	}
+}
+
+func indexEntries(results []batchResult) []output.IndexEntry {
+	entries := make([]output.IndexEntry, len(results))
+	for i, r := range results {
+		entries[i] = output.IndexEntry{
+			InputPath:  r.summary.inputPath,
+			OutputPath: r.summary.outputPath,
+			Duration:   r.summary.duration,
+			Keyframes:  r.summary.keyframes,
+			Segments:   r.summary.segments,
+			Tokens:     r.summary.tokens,
+		}
+		if r.err != nil {
+			entries[i].Error = r.err.Error()
+		}
+	}
+	return entries
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates empty files at the given paths under dir
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir,
+		"talk.mp4",
+		"notes.txt",
+		"clips/a.MOV",
+		"clips/b.m4a",
+		"clips/readme.md",
+		"clips/nested/c.webm",
+		"talk [v2].mp4",
+		"talk 2.mp4",
+	)
+	in := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "file",
+			args: []string{in("talk.mp4")},
+			want: []string{in("talk.mp4")},
+		},
+		{
+			name: "named files are kept whatever the extension",
+			args: []string{in("notes.txt")},
+			want: []string{in("notes.txt")},
+		},
+		{
+			name: "directory picks media by extension, recursively",
+			args: []string{in("clips")},
+			want: []string{in("clips/a.MOV"), in("clips/b.m4a"), in("clips/nested/c.webm")},
+		},
+		{
+			name: "glob",
+			args: []string{in("talk.*")},
+			want: []string{in("talk.mp4")},
+		},
+		{
+			name: "existing file that looks like a glob",
+			args: []string{in("talk [v2].mp4"), in("talk.mp4")},
+			want: []string{in("talk [v2].mp4"), in("talk.mp4")},
+		},
+		{
+			name: "glob matching a directory",
+			args: []string{in("cl*")},
+			want: []string{in("clips/a.MOV"), in("clips/b.m4a"), in("clips/nested/c.webm")},
+		},
+		{
+			name: "repeats are removed, in argument order",
+			args: []string{in("clips/b.m4a"), in("clips"), dir + "/./talk.mp4", in("talk.mp4")},
+			want: []string{in("clips/b.m4a"), in("clips/a.MOV"), in("clips/nested/c.webm"), in("talk.mp4")},
+		},
+		{
+			name: "URLs and standard input pass through",
+			args: []string{"https://example.com/talk.mp4", "-", "https://example.com/talk.mp4"},
+			want: []string{"https://example.com/talk.mp4", "-"},
+		},
+		{
+			name:    "missing file",
+			args:    []string{in("missing.mp4")},
+			wantErr: "does not exist",
+		},
+		{
+			name:    "glob without matches",
+			args:    []string{in("*.mkv")},
+			wantErr: "no files match",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandInputs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandInputs failed: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandInputs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandInputsNoMedia(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "notes.txt")
+
+	if _, err := expandInputs([]string{dir}); err == nil || !strings.Contains(err.Error(), "no media files") {
+		t.Errorf("Expected a directory without media to fail, got %v", err)
+	}
+}
+
+func TestBatchOutputPath(t *testing.T) {
+	oldOutput, oldFormat := outputPath, format
+	t.Cleanup(func() { outputPath, format = oldOutput, oldFormat })
+
+	tests := []struct {
+		outputDir string
+		format    string
+		input     string
+		want      string
+	}{
+		{"", formatMarkdown, "/videos/talk.mp4", "/videos/talk_memorex.md"},
+		{"", formatJSON, "/videos/talk.mp4", "/videos/talk_memorex.json"},
+		{"/out", formatMarkdown, "/videos/talk.mp4", "/out/talk_memorex.md"},
+		{"/out", formatMarkdown, "https://example.com/media/talk.mp4?dl=1", "/out/talk_memorex.md"},
+	}
+	for _, tt := range tests {
+		outputPath, format = tt.outputDir, tt.format
+		if got := batchOutputPath(tt.input); got != tt.want {
+			t.Errorf("batchOutputPath(%q) with -o %q -f %s = %q, want %q", tt.input, tt.outputDir, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestRunBatchOutputCollision(t *testing.T) {
+	oldOutput, oldFormat := outputPath, format
+	t.Cleanup(func() { outputPath, format = oldOutput, oldFormat })
+	outputPath, format = filepath.Join(t.TempDir(), "out"), formatMarkdown
+
+	// Same-named files from different directories meet in -o
+	err := runBatch([]string{"/a/talk.mp4", "/b/talk.mp4"})
+	if err == nil || !strings.Contains(err.Error(), "would both write") {
+		t.Fatalf("Expected a collision error, got %v", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be created before the collision is reported")
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jayzes/memorex/internal/audio"
+	"github.com/jayzes/memorex/internal/cache"
+	"github.com/jayzes/memorex/internal/video"
+)
+
+// cacheVersion is part of every cache key. Bump it when a stage's output
+// changes for the same parameters, so stale entries are ignored.
+const cacheVersion = 9
+
+// frameParams identifies how frames are sampled from the video
+type frameParams struct {
+	Sampler        video.Sampler
+	FPS            float64           `json:",omitempty"`
+	SceneThreshold float64           `json:",omitempty"`
+	Ranges         []video.TimeRange `json:",omitempty"`
+}
+
+// scoreParams identifies a frame scoring run
+type scoreParams struct {
+	Version int
+	Frames  frameParams
+	Metric  string
+	Compare video.CompareMode
+	Size    int            // Long edge of comparison thumbnails
+	Crop    *video.Region  `json:",omitempty"`
+	Ignore  []video.Region `json:",omitempty"`
+	// Threshold is set only for comparisons against the last keyframe, whose
+	// scores depend on which frames were accepted
+	Threshold float64 `json:",omitempty"`
+}
+
+// imageParams identifies the sampled frames that full-resolution keyframe
+// images are cut from. Images are cached per frame, so a different selection
+// of keyframes only extracts the frames that aren't cached yet.
+type imageParams struct {
+	Version int
+	Frames  frameParams
+}
+
+// scanResult is the cached output of frame scoring
+type scanResult struct {
+	Frames []video.Frame
+	Scores []float64
+}
+
+// transcriptParams identifies a transcription run
+type transcriptParams struct {
+	Version   int
+	Model     string
+	ModelSize int64
+	Ranges    []video.TimeRange `json:",omitempty"`
+	Language  string            `json:",omitempty"`
+	Translate bool              `json:",omitempty"`
+	Diarize   audio.Diarization `json:",omitempty"`
+}
+
+// openCache returns the cache entry for the job's input, or nil if caching is
+// disabled or unavailable
+func (j *job) openCache() *cache.Input {
+	if noCache {
+		return nil
+	}
+
+	dir := cacheDir
+	if dir == "" {
+		var err error
+		if dir, err = cache.DefaultDir(); err != nil {
+			j.warn(fmt.Sprintf("Cache disabled: %v", err))
+			return nil
+		}
+	}
+
+	c, err := cache.Open(dir)
+	if err != nil {
+		j.warn(fmt.Sprintf("Cache disabled: %v", err))
+		return nil
+	}
+
+	var entry *cache.Input
+	if isURL(j.mediaPath) {
+		entry, err = c.ForURL(j.mediaPath)
+	} else {
+		entry, err = c.ForInput(j.mediaPath)
+	}
+	if err != nil {
+		j.warn(fmt.Sprintf("Cache disabled: %v", err))
+		return nil
+	}
+	return entry
+}
+
+// extractOptions returns the frame sampling options selected by flags
+func extractOptions() video.ExtractOptions {
+	return video.ExtractOptions{
+		Sampler:        frameSampler,
+		FPS:            fps,
+		SceneThreshold: sceneScore,
+		Ranges:         timeRanges,
+	}
+}
+
+// sampleParams returns the cache parameters for the frame sampling options
+func sampleParams(opts video.ExtractOptions) frameParams {
+	if opts.Sampler == video.SamplerScene {
+		return frameParams{Sampler: opts.Sampler, SceneThreshold: opts.SceneThreshold, Ranges: opts.Ranges}
+	}
+	return frameParams{Sampler: opts.Sampler, FPS: opts.FPS, Ranges: opts.Ranges}
+}
+
+// scoreFrames samples and scores frames for keyframe detection, reusing
+// cached scores for the same input and settings when available. stream is
+// the probed video stream, which gives the frame size. It reports whether the
+// scores came from the cache.
+func (j *job) scoreFrames(entry *cache.Input, stream *video.VideoStream, duration time.Duration, onProgress video.ProgressFunc) ([]video.Frame, []float64, bool, error) {
+	extract := extractOptions()
+	detect := video.DetectOptions{
+		Threshold:      threshold,
+		Compare:        compareMode,
+		Metric:         similarity,
+		ComparisonSize: compareSize,
+		Crop:           cropRegion,
+		Ignore:         ignoreRegions,
+	}
+
+	var key string
+	if entry != nil {
+		params := scoreParams{
+			Version: cacheVersion,
+			Frames:  sampleParams(extract),
+			Metric:  similarity.Name(),
+			Compare: compareMode,
+			Size:    compareSize,
+			Crop:    cropRegion,
+			Ignore:  ignoreRegions,
+		}
+		if compareMode != video.CompareConsecutive {
+			params.Threshold = threshold
+		}
+
+		var err error
+		key, err = cache.Key("scores", params)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		var scan scanResult
+		found, err := entry.Load(key, &scan)
+		if err != nil {
+			j.warn(fmt.Sprintf("Ignoring cached scores: %v", err))
+		}
+		if found && err == nil && len(scan.Frames) > 0 && len(scan.Scores) == len(scan.Frames) {
+			return scan.Frames, scan.Scores, true, nil
+		}
+	}
+
+	width, height := stream.DisplaySize()
+	frames, scores, err := video.StreamFrames(j.mediaPath, width, height, duration, extract, detect, onProgress)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if entry != nil {
+		if err := entry.Store(key, scanResult{Frames: frames, Scores: scores}); err != nil {
+			j.warn(fmt.Sprintf("Could not cache frame scores: %v", err))
+		}
+	}
+
+	return frames, scores, false, nil
+}
+
+// extractKeyframeImages writes the keyframes at full resolution and sets
+// their paths, reusing cached images of the same sampled frames when
+// available and extracting only the rest. Repeats marked by --dedupe have no
+// image of their own. cleanup removes the images if they are not kept in the
+// cache.
+func (j *job) extractKeyframeImages(entry *cache.Input, frames []video.Frame, keyframes []video.Keyframe, duration time.Duration) (cleanup func(), err error) {
+	step := j.step("Extracting keyframes")
+	cleanup = func() {}
+	extract := extractOptions()
+
+	var originals []int
+	for i, kf := range keyframes {
+		if kf.DuplicateOf == 0 {
+			originals = append(originals, i)
+		}
+	}
+
+	if entry == nil {
+		dir, err := os.MkdirTemp("", "memorex-frames-*")
+		if err == nil {
+			cleanup = func() { _ = os.RemoveAll(dir) }
+			err = video.ExtractKeyframeImages(j.mediaPath, dir, frames, keyframes, extract, duration, step.Update)
+		}
+		if err != nil {
+			step.Error("Keyframe extraction failed")
+			return cleanup, fmt.Errorf("keyframe extraction failed: %w", err)
+		}
+		step.Complete(fmt.Sprintf("Extracted %d keyframes", len(originals)))
+		return cleanup, nil
+	}
+
+	key, err := cache.Key("keyframes", imageParams{Version: cacheVersion, Frames: sampleParams(extract)})
+	if err != nil {
+		step.Error("Keyframe extraction failed")
+		return cleanup, err
+	}
+	dir := entry.Dir(key)
+
+	// The manifest maps sampled frame indices to image names in dir
+	images := map[int]string{}
+	if _, err := entry.Load(key, &images); err != nil {
+		j.warn(fmt.Sprintf("Ignoring cached keyframes: %v", err))
+		images = map[int]string{}
+	}
+
+	var missing []video.Keyframe
+	var missingAt []int
+	for _, k := range originals {
+		kf := keyframes[k]
+		if name, ok := images[kf.Index]; ok {
+			// Guard against images removed from under the manifest
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				keyframes[k].Path = filepath.Join(dir, name)
+				continue
+			}
+		}
+		missing = append(missing, kf)
+		missingAt = append(missingAt, k)
+	}
+	if len(missing) == 0 {
+		step.Complete(fmt.Sprintf("Extracted %d keyframes (cached)", len(originals)))
+		return cleanup, nil
+	}
+
+	// Extract into a scratch directory, since ffmpeg numbers its images from
+	// 1, then file each image under its frame index
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		step.Error("Keyframe extraction failed")
+		return cleanup, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	scratch, err := os.MkdirTemp(dir, "extract-*")
+	if err != nil {
+		step.Error("Keyframe extraction failed")
+		return cleanup, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(scratch) }()
+
+	if err := video.ExtractKeyframeImages(j.mediaPath, scratch, frames, missing, extract, duration, step.Update); err != nil {
+		step.Error("Keyframe extraction failed")
+		return cleanup, fmt.Errorf("keyframe extraction failed: %w", err)
+	}
+	for i, kf := range missing {
+		name := fmt.Sprintf("frame_%06d%s", kf.Index, filepath.Ext(kf.Path))
+		path := filepath.Join(dir, name)
+		if err := os.Rename(kf.Path, path); err != nil {
+			step.Error("Keyframe extraction failed")
+			return cleanup, fmt.Errorf("failed to cache keyframe: %w", err)
+		}
+		keyframes[missingAt[i]].Path = path
+		images[kf.Index] = name
+	}
+
+	if err := entry.Store(key, images); err != nil {
+		j.warn(fmt.Sprintf("Could not cache keyframes: %v", err))
+	}
+
+	if cached := len(originals) - len(missing); cached > 0 {
+		step.Complete(fmt.Sprintf("Extracted %d keyframes (%d cached)", len(originals), cached))
+	} else {
+		step.Complete(fmt.Sprintf("Extracted %d keyframes", len(originals)))
+	}
+	return cleanup, nil
+}
+
+// transcribe extracts and transcribes the audio track, or the selected time
+// ranges of it, reusing a cached transcript made with the same model and
+// language when available. Segment times are relative to the start of the
+// input. With language detection, the first range's language is reported.
+// Speaker turns use the tinydiarize model rather than --model, and are
+// numbered from Speaker 1 again in each range.
+func (j *job) transcribe(entry *cache.Input, duration time.Duration) (audio.Transcript, error) {
+	opts := transcribeOpts
+	opts.Diarize = j.diarize
+	model := modelPath
+	if opts.Diarize == audio.DiarizeTurns {
+		model = turnsModelPath
+	}
+	if err := j.ensureModel(model); err != nil {
+		return audio.Transcript{}, err
+	}
+
+	var key string
+	if entry != nil {
+		params := transcriptParams{
+			Version:   cacheVersion,
+			Model:     model,
+			Ranges:    timeRanges,
+			Language:  opts.Language,
+			Translate: opts.Translate,
+			Diarize:   opts.Diarize,
+		}
+		if abs, err := filepath.Abs(model); err == nil {
+			params.Model = abs
+		}
+		if info, err := os.Stat(model); err == nil {
+			params.ModelSize = info.Size()
+		}
+
+		var err error
+		key, err = cache.Key("transcript", params)
+		if err != nil {
+			return audio.Transcript{}, err
+		}
+
+		var transcript audio.Transcript
+		found, err := entry.Load(key, &transcript)
+		if err != nil {
+			j.warn(fmt.Sprintf("Ignoring cached transcript: %v", err))
+		}
+		if found && err == nil {
+			step := j.step("Transcribing")
+			step.Complete(fmt.Sprintf("Transcribed %d segments (cached)", len(transcript.Segments)))
+			return transcript, nil
+		}
+	}
+
+	clips := timeRanges
+	if len(clips) == 0 {
+		clips = []video.TimeRange{{}}
+	}
+	var total time.Duration
+	for _, clip := range clips {
+		total += clip.Length(duration)
+	}
+
+	// Step: Extract audio
+	step := j.step("Extracting audio")
+	audioPaths := make([]string, 0, len(clips))
+	defer func() {
+		for _, path := range audioPaths {
+			_ = os.Remove(path)
+		}
+	}()
+	var done time.Duration
+	for _, clip := range clips {
+		length := clip.Length(duration)
+		extract := audio.ExtractAudioClip
+		if opts.Diarize == audio.DiarizeStereo {
+			extract = audio.ExtractStereoClip
+		}
+		path, err := extract(j.mediaPath, clip.Start, clip.End, length, spanProgress(step.Update, done, length, total))
+		if err != nil {
+			step.Error("Audio extraction failed")
+			return audio.Transcript{}, fmt.Errorf("audio extraction failed: %w", err)
+		}
+		audioPaths = append(audioPaths, path)
+		done += length
+	}
+	step.Complete("Audio extracted")
+
+	// Step: Transcribe each clip, shifting its times back into the input
+	step = j.step("Transcribing")
+	var transcript audio.Transcript
+	done = 0
+	for i, clip := range clips {
+		length := clip.Length(duration)
+		clipTranscript, err := audio.TranscribeAudioWithOptions(audioPaths[i], model, opts,
+			spanProgress(step.Update, done, length, total))
+		if err != nil {
+			step.Error("Transcription failed")
+			return audio.Transcript{}, fmt.Errorf("transcription failed: %w", err)
+		}
+		for _, seg := range clipTranscript.Segments {
+			transcript.Segments = append(transcript.Segments, seg.Shift(clip.Start))
+		}
+		if transcript.Language == "" {
+			transcript.Language = clipTranscript.Language
+		}
+		done += length
+	}
+	step.Complete(fmt.Sprintf("Transcribed %d segments", len(transcript.Segments)))
+
+	if entry != nil {
+		if err := entry.Store(key, transcript); err != nil {
+			j.warn(fmt.Sprintf("Could not cache transcript: %v", err))
+		}
+	}
+
+	return transcript, nil
+}
+
+// spanProgress maps progress through a span of length starting at done onto
+// progress through total. It reports nothing if total is unknown, unless the
+// span is all there is.
+func spanProgress(onProgress func(float64), done, length, total time.Duration) func(float64) {
+	if length == total {
+		return onProgress
+	}
+	if total <= 0 {
+		return nil
+	}
+	return func(p float64) {
+		onProgress((float64(done) + p*float64(length)) / float64(total))
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jayzes/memorex/internal/cache"
+	"github.com/jayzes/memorex/internal/video"
+)
+
+func TestExtractKeyframeImagesCached(t *testing.T) {
+	c, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	inputPath := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(inputPath, []byte("video data"), 0o600); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+	entry, err := c.ForInput(inputPath)
+	if err != nil {
+		t.Fatalf("ForInput failed: %v", err)
+	}
+
+	// Images of frames 2 and 5, cached by an earlier selection
+	key, err := cache.Key("keyframes", imageParams{Version: cacheVersion, Frames: sampleParams(extractOptions())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := entry.Dir(key)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	images := map[int]string{2: "frame_000002.png", 5: "frame_000005.png"}
+	for _, name := range images {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("png"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := entry.Store(key, images); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	// A new selection of cached frames needs no extraction, which would fail
+	// on the fake input
+	keyframes := []video.Keyframe{{Index: 5}, {Index: 7, DuplicateOf: 5}}
+	j := &job{inputPath: inputPath, mediaPath: inputPath, quiet: true}
+	if _, err := j.extractKeyframeImages(entry, nil, keyframes, 0); err != nil {
+		t.Fatalf("extractKeyframeImages failed: %v", err)
+	}
+	if want := filepath.Join(dir, "frame_000005.png"); keyframes[0].Path != want {
+		t.Errorf("Expected the cached image %s, got %s", want, keyframes[0].Path)
+	}
+	if keyframes[1].Path != "" {
+		t.Errorf("Expected the repeat to have no image, got %s", keyframes[1].Path)
+	}
+
+	// A frame that isn't cached has to be extracted
+	if _, err := j.extractKeyframeImages(entry, nil, []video.Keyframe{{Index: 3}}, 0); err == nil {
+		t.Errorf("Expected extracting an uncached frame from the fake input to fail")
+	}
+}
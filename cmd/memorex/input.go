@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jayzes/memorex/internal/output"
+)
+
+// stdinArg is the input argument that reads media from standard input
+const stdinArg = "-"
+
+// isURL reports whether an input is an http(s) URL, which ffmpeg reads
+// directly
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// isLocal reports whether an input is a path on disk
+func isLocal(input string) bool {
+	return input != stdinArg && !isURL(input)
+}
+
+// openMedia returns the path ffmpeg should read for the job's input. Standard
+// input is spooled to a temp file first, since every stage seeks in the
+// media; cleanup removes it.
+func (j *job) openMedia() (path string, cleanup func(), err error) {
+	if j.inputPath != stdinArg {
+		return j.inputPath, func() {}, nil
+	}
+
+	step := j.step("Reading standard input")
+	path, err = spoolStdin()
+	if err != nil {
+		step.Error("Reading standard input failed")
+		return "", func() {}, err
+	}
+	step.Complete("Standard input read")
+	return path, func() { _ = os.Remove(path) }, nil
+}
+
+// spoolStdin copies standard input to a temp file
+func spoolStdin() (string, error) {
+	file, err := os.CreateTemp("", "memorex-stdin-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	if _, err := io.Copy(file, os.Stdin); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return "", fmt.Errorf("failed to read standard input: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return "", fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	info, err := os.Stat(file.Name())
+	if err == nil && info.Size() == 0 {
+		_ = os.Remove(file.Name())
+		return "", fmt.Errorf("standard input is empty")
+	}
+	return file.Name(), nil
+}
+
+// outputBase returns the output path without its _memorex suffix: next to a
+// local input, or in the current directory, named after the URL's file (or
+// host, for a URL without a path) or "stdin"
+func outputBase(input string) string {
+	if isLocal(input) {
+		return strings.TrimSuffix(input, filepath.Ext(input))
+	}
+	name := output.InputName(input)
+	// A host's domain is not a file extension
+	if u, err := url.Parse(input); err == nil && name == u.Host {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
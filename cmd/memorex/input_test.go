@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setStdin replaces standard input with a file holding content
+func setStdin(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = old
+		_ = file.Close()
+	})
+}
+
+func TestSpoolStdin(t *testing.T) {
+	setStdin(t, "media data")
+
+	path, err := spoolStdin()
+	if err != nil {
+		t.Fatalf("spoolStdin failed: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Remove(path) })
+
+	got, err := os.ReadFile(path)
+	if err != nil || string(got) != "media data" {
+		t.Errorf("Expected the spooled file to hold standard input, got %q, %v", got, err)
+	}
+}
+
+func TestSpoolStdinEmpty(t *testing.T) {
+	setStdin(t, "")
+	// Spooled files would be left here if they weren't cleaned up
+	t.Setenv("TMPDIR", t.TempDir())
+
+	if _, err := spoolStdin(); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Fatalf("Expected empty standard input to fail, got %v", err)
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(os.TempDir(), "memorex-stdin-*")); len(leftover) != 0 {
+		t.Errorf("Expected the empty spool file to be removed, found %q", leftover)
+	}
+}
+
+func TestDefaultOutputPath(t *testing.T) {
+	oldFormat := format
+	t.Cleanup(func() { format = oldFormat })
+
+	tests := []struct {
+		input  string
+		format string
+		want   string
+	}{
+		{"/videos/talk.mp4", formatMarkdown, "/videos/talk_memorex.md"},
+		{"talk.mp4", formatJSON, "talk_memorex.json"},
+		{"-", formatMarkdown, "stdin_memorex.md"},
+		{"-", formatJSON, "stdin_memorex.json"},
+		{"https://example.com/media/talk.mp4", formatMarkdown, "talk_memorex.md"},
+		{"https://example.com/media/talk.mp4?dl=1&t=30", formatMarkdown, "talk_memorex.md"},
+		{"http://example.com/watch?v=abc", formatMarkdown, "watch_memorex.md"},
+		{"https://example.com/media/", formatMarkdown, "media_memorex.md"},
+		{"https://cdn.example.com", formatMarkdown, "cdn.example.com_memorex.md"},
+		{"https://cdn.example.com/?v=abc", formatJSON, "cdn.example.com_memorex.json"},
+	}
+	for _, tt := range tests {
+		format = tt.format
+		if got := defaultOutputPath(tt.input); got != tt.want {
+			t.Errorf("defaultOutputPath(%q) with -f %s = %q, want %q", tt.input, tt.format, got, tt.want)
+		}
+	}
+}
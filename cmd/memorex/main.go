@@ -18,35 +18,129 @@ import (
 )
 
 var (
-	outputPath   string
-	threshold    float64
-	quality      int
-	scale        float64
-	modelPath    string
-	noTranscript bool
-	noFrames     bool
+	outputPath    string
+	threshold     float64
+	quality       int
+	scale         float64
+	modelPath     string
+	modelName     string
+	language      string
+	translate     bool
+	lowConfidence float64
+	diarize       bool
+	speakers      []string
+	noTranscript  bool
+	noFrames      bool
+	format        string
+	jsonSidecar   bool
+	subtitles     string
+	layout        string
+	noChapters    bool
+	maxTokens     int
+	jobs          int
+	indexPath     string
+	noCache       bool
+	cacheDir      string
+	fps           float64
+	sampler       string
+	sceneScore    float64
+	compare       string
+	metric        string
+	compareSize   int
+	ignore        []string
+	crop          string
+	pick          string
+	settleWindow  int
+	dedupe        bool
+	dedupeDist    int
+	minInterval   float64
+	maxInterval   float64
+	maxKeyframes  int
+	startAt       string
+	endAt         string
+	ranges        []string
+
+	// Parsed from flags by validateFlags
+	markdownLayout output.Layout
+	subtitleFormat output.SubtitleFormat
+	frameSampler   video.Sampler
+	compareMode    video.CompareMode
+	similarity     video.Similarity
+	ignoreRegions  []video.Region
+	cropRegion     *video.Region
+	keyframeChoice video.KeyframeChoice
+	timeRanges     []video.TimeRange
+	transcribeOpts audio.TranscribeOptions
+	// turnsModelPath is the tinydiarize model, set by resolveModel with
+	// --diarize
+	turnsModelPath string
+	// turnsOverride names the --model or --model-name that speaker turns
+	// replace with turnsModelPath, "" if none was chosen
+	turnsOverride string
+)
+
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
 )
 
 func main() {
 	rootCmd := &cobra.Command{
-		Use:   "memorex [options] <video-file>",
+		Use:   "memorex [options] <file|dir|glob|url|->...",
 		Short: "Convert video/audio files into Claude-friendly markdown",
 		Long: `Memorex processes video and audio files to extract transcripts and keyframes,
-generating structured markdown suitable for analysis by Claude or other LLMs.`,
-		Args: cobra.ExactArgs(1),
+generating structured markdown suitable for analysis by Claude or other LLMs.
+
+Pass several files, directories or glob patterns to process them as a batch.
+Inputs may also be http(s) URLs, which ffmpeg reads directly, or - to read
+from standard input.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: run,
 	}
 
-	homeDir, _ := os.UserHomeDir()
-	defaultModel := filepath.Join(homeDir, ".cache", "whisper", "ggml-base.bin")
+	rootCmd.AddCommand(newModelsCmd())
 
-	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file path (default: <input>_memorex.md)")
+	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file path, or output directory for batches (default: <input>_memorex.md)")
+	rootCmd.Flags().StringVar(&startAt, "start", "", "Process from this time in the input, as seconds, M:SS or H:MM:SS")
+	rootCmd.Flags().StringVar(&endAt, "end", "", "Process up to this time in the input, as seconds, M:SS or H:MM:SS")
+	rootCmd.Flags().StringArrayVar(&ranges, "range", nil, "Process only start-end of the input, e.g. 12:00-18:00 (repeatable)")
 	rootCmd.Flags().Float64VarP(&threshold, "threshold", "t", 0.85, "Frame similarity threshold 0.0-1.0")
+	rootCmd.Flags().StringVar(&compare, "compare", string(video.CompareConsecutive), "Compare frames against: consecutive (previous frame), keyframe (last keyframe) or both")
+	rootCmd.Flags().StringVar(&metric, "metric", video.MetricNCC, "Frame similarity metric: ncc, ssim, dhash, phash or histogram")
+	rootCmd.Flags().IntVar(&compareSize, "comparison-size", video.DefaultComparisonSize, "Long edge in pixels of the thumbnails frames are compared at")
+	rootCmd.Flags().StringArrayVar(&ignore, "ignore-region", nil, "Leave a region out of frame comparison, as relative x,y,w,h (repeatable)")
+	rootCmd.Flags().StringVar(&crop, "crop", "", "Compare only this region of the frame, as relative x,y,w,h")
+	rootCmd.Flags().Float64Var(&minInterval, "min-interval", 0, "Fewest seconds between keyframes; changes sooner than that are deferred (0 = no minimum)")
+	rootCmd.Flags().Float64Var(&maxInterval, "max-interval", 0, "Force a keyframe after this many seconds without a change (0 = no maximum)")
+	rootCmd.Flags().IntVar(&maxKeyframes, "max-keyframes", 0, "Keep at most this many keyframes, the most dissimilar ones (0 = no limit)")
+	rootCmd.Flags().StringVar(&pick, "pick", string(video.ChooseFirst), "Frame saved for each change: first, sharpest or stable (once the content settles)")
+	rootCmd.Flags().IntVar(&settleWindow, "settle-window", 5, "Frames after a change to consider with --pick sharpest or stable")
+	rootCmd.Flags().BoolVar(&dedupe, "dedupe", false, "Collapse keyframes that repeat an earlier one anywhere in the video")
+	rootCmd.Flags().IntVar(&dedupeDist, "dedupe-distance", video.DefaultDedupeDistance, "Most perceptual hash bits (of 64) repeats may differ by with --dedupe")
 	rootCmd.Flags().IntVarP(&quality, "quality", "q", 30, "JPEG quality 1-100")
 	rootCmd.Flags().Float64VarP(&scale, "scale", "s", 0.5, "Frame scale factor")
-	rootCmd.Flags().StringVarP(&modelPath, "model", "m", defaultModel, "Whisper model path")
+	rootCmd.Flags().BoolVar(&diarize, "diarize", false, "Label transcript segments by speaker: by channel for stereo audio, otherwise by speaker turns (English only)")
+	rootCmd.Flags().StringSliceVar(&speakers, "speakers", nil, "Names for the speakers --diarize finds, in order, e.g. \"Alice,Bob\"")
+	rootCmd.Flags().StringVar(&modelName, "model-name", audio.DefaultModelName, "Whisper model: tiny, base, small, medium, large-v3 or large-v3-q5_0 (see memorex models list)")
+	rootCmd.Flags().StringVarP(&modelPath, "model", "m", "", "Whisper model file, instead of --model-name (default: in $MEMOREX_MODEL_DIR or ~/.cache/whisper)")
+	rootCmd.Flags().StringVar(&language, "language", "en", "Spoken language as a code such as en, es or de, or auto to detect it")
+	rootCmd.Flags().BoolVar(&translate, "translate", false, "Translate the speech to English")
+	rootCmd.Flags().Float64Var(&lowConfidence, "low-confidence", 0.4, "Mark transcript words whisper is less sure of than this (0.0-1.0) as [?word?]; 0 to mark none")
+	rootCmd.Flags().Float64Var(&fps, "fps", 1, "Frames sampled per second with --sampler fps (fractions allowed, e.g. 0.2 or 2)")
+	rootCmd.Flags().StringVar(&sampler, "sampler", string(video.SamplerFPS), "Frame sampler: fps (fixed rate) or scene (ffmpeg scene-change detection)")
+	rootCmd.Flags().Float64Var(&sceneScore, "scene-threshold", 0.3, "Minimum ffmpeg scene score 0.0-1.0 for --sampler scene")
 	rootCmd.Flags().BoolVar(&noTranscript, "no-transcript", false, "Skip audio transcription")
 	rootCmd.Flags().BoolVar(&noFrames, "no-frames", false, "Skip frame extraction (audio only)")
+	rootCmd.Flags().StringVarP(&format, "format", "f", formatMarkdown, "Output format: markdown or json")
+	rootCmd.Flags().BoolVar(&jsonSidecar, "json", false, "Also write a JSON sidecar next to the markdown output")
+	rootCmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Fit the output within this token estimate by lowering scale and dropping keyframes (0 = no limit)")
+	rootCmd.Flags().StringVar(&layout, "layout", string(output.LayoutStandard), "Markdown layout: standard or storyboard")
+	rootCmd.Flags().BoolVar(&noChapters, "no-chapters", false, "Ignore chapter markers in the input instead of splitting the markdown into chapters")
+	rootCmd.Flags().StringVar(&subtitles, "subtitles", "", "Also write a caption file from the transcript: srt or vtt")
+	rootCmd.Flags().IntVarP(&jobs, "jobs", "j", 2, "Number of files to process in parallel in a batch")
+	rootCmd.Flags().BoolVar(&noCache, "no-cache", false, "Don't read or write cached frames, scores and transcripts")
+	rootCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Cache directory (default: $MEMOREX_CACHE_DIR or the user cache dir)")
+	rootCmd.Flags().StringVar(&indexPath, "index", "", "Write an index markdown linking to each file's result (batches only)")
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -54,135 +148,257 @@ generating structured markdown suitable for analysis by Claude or other LLMs.`,
 }
 
 func run(_ *cobra.Command, args []string) error {
-	inputPath := args[0]
-
-	// Validate input file exists
-	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
-		return fmt.Errorf("input file does not exist: %s", inputPath)
+	if err := validateFlags(); err != nil {
+		return err
 	}
-
-	// Determine output path
-	if outputPath == "" {
-		ext := filepath.Ext(inputPath)
-		base := strings.TrimSuffix(inputPath, ext)
-		outputPath = base + "_memorex.md"
+	if err := resolveModel(); err != nil {
+		return err
 	}
 
-	// Create frames directory
-	framesDir := strings.TrimSuffix(outputPath, ".md") + "_frames"
-	if !noFrames {
-		if err := os.MkdirAll(framesDir, 0o750); err != nil {
-			return fmt.Errorf("failed to create frames directory: %w", err)
+	// A single file keeps the interactive step-by-step output
+	if len(args) == 1 && indexPath == "" {
+		if !isLocal(args[0]) {
+			return runSingle(args[0])
+		}
+		if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+			return runSingle(args[0])
 		}
 	}
 
-	ui.PrintHeader("memorex")
-	ui.PrintInfo(fmt.Sprintf("Processing: %s", filepath.Base(inputPath)))
-
-	// Get video duration
-	duration, err := video.GetDuration(inputPath)
+	inputs, err := expandInputs(args)
 	if err != nil {
-		ui.PrintWarning(fmt.Sprintf("Could not get duration: %v", err))
-	} else {
-		ui.PrintInfo(fmt.Sprintf("Duration: %s", formatDuration(duration)))
+		return err
+	}
+	return runBatch(inputs)
+}
+
+// validateFlags checks flag values and parses the ones with a fixed set of choices
+func validateFlags() error {
+	if format != formatMarkdown && format != formatJSON {
+		return fmt.Errorf("invalid format %q: must be %s or %s", format, formatMarkdown, formatJSON)
 	}
-	fmt.Fprintln(os.Stderr)
 
-	var keyframes []video.Keyframe
-	var totalFrames int
+	var err error
+	if markdownLayout, err = output.ParseLayout(layout); err != nil {
+		return err
+	}
+	if maxTokens < 0 {
+		return fmt.Errorf("--max-tokens can't be negative")
+	}
 
-	// Extract and process frames
-	if !noFrames {
-		// Step 1: Extract frames
-		step := ui.NewStep("Extracting frames")
-		frames, err := video.ExtractFrames(inputPath, duration, step.Update)
-		if err != nil {
-			step.Error("Frame extraction failed")
-			return fmt.Errorf("frame extraction failed: %w", err)
+	if subtitles != "" {
+		if noTranscript {
+			return fmt.Errorf("--subtitles requires a transcript and cannot be combined with --no-transcript")
+		}
+		if subtitleFormat, err = output.ParseSubtitleFormat(subtitles); err != nil {
+			return err
 		}
-		totalFrames = len(frames)
-		step.Complete(fmt.Sprintf("Extracted %d frames", totalFrames))
+	}
 
-		// Step 2: Detect keyframes
-		step = ui.NewStep("Detecting keyframes")
-		keyframes, err = video.DetectKeyframes(frames, threshold, step.Update)
+	if frameSampler, err = video.ParseSampler(sampler); err != nil {
+		return err
+	}
+	if compareMode, err = video.ParseCompareMode(compare); err != nil {
+		return err
+	}
+	// The reference frame moves as frames are scored, before spacing and the
+	// cap drop keyframes, so it would end up on frames that aren't kept
+	if compareMode != video.CompareConsecutive && (minInterval > 0 || maxInterval > 0 || maxKeyframes > 0) {
+		return fmt.Errorf("--compare %s can't be combined with --min-interval, --max-interval or --max-keyframes", compareMode)
+	}
+	if similarity, err = video.ParseMetric(metric); err != nil {
+		return err
+	}
+	if compareSize < 16 {
+		return fmt.Errorf("--comparison-size must be at least 16")
+	}
+	ignoreRegions = nil
+	for _, spec := range ignore {
+		region, err := video.ParseRegion(spec)
 		if err != nil {
-			step.Error("Keyframe detection failed")
-			return fmt.Errorf("keyframe detection failed: %w", err)
+			return fmt.Errorf("--ignore-region: %w", err)
 		}
-		step.Complete(fmt.Sprintf("Found %d keyframes", len(keyframes)))
-
-		// Step 3: Save keyframes
-		step = ui.NewStep("Saving keyframes")
-		if err := video.SaveKeyframes(keyframes, framesDir, quality, scale, step.Update); err != nil {
-			step.Error("Failed to save keyframes")
-			return fmt.Errorf("failed to save keyframes: %w", err)
+		ignoreRegions = append(ignoreRegions, region)
+	}
+	if crop != "" {
+		region, err := video.ParseRegion(crop)
+		if err != nil {
+			return fmt.Errorf("--crop: %w", err)
 		}
-		step.Complete("Keyframes saved")
+		cropRegion = &region
 	}
 
-	var segments []audio.Segment
+	if timeRanges, err = parseTimeRanges(); err != nil {
+		return err
+	}
 
-	// Transcribe audio
-	if !noTranscript {
-		// Step: Download model if needed
-		if !audio.ModelExists(modelPath) {
-			step := ui.NewStep("Downloading whisper model")
-			if err := audio.DownloadModel(modelPath, step.Update); err != nil {
-				step.Error("Model download failed")
-				return fmt.Errorf("failed to download model: %w", err)
-			}
-			step.Complete("Model downloaded")
+	if transcribeOpts.Language, err = audio.ParseLanguage(language); err != nil {
+		return fmt.Errorf("--language: %w", err)
+	}
+	transcribeOpts.Translate = translate
+	if lowConfidence < 0 || lowConfidence > 1 {
+		return fmt.Errorf("--low-confidence must be between 0.0 and 1.0")
+	}
+	if diarize && noTranscript {
+		return fmt.Errorf("--diarize requires a transcript and cannot be combined with --no-transcript")
+	}
+	if len(speakers) > 0 && !diarize {
+		return fmt.Errorf("--speakers requires --diarize")
+	}
+	for i, name := range speakers {
+		speakers[i] = strings.TrimSpace(name)
+	}
+
+	if keyframeChoice, err = video.ParseKeyframeChoice(pick); err != nil {
+		return err
+	}
+	if settleWindow < 1 {
+		return fmt.Errorf("--settle-window must be at least 1")
+	}
+	if minInterval < 0 || maxInterval < 0 {
+		return fmt.Errorf("--min-interval and --max-interval can't be negative")
+	}
+	if maxInterval > 0 && maxInterval < minInterval {
+		return fmt.Errorf("--max-interval must be at least --min-interval")
+	}
+	if maxKeyframes < 0 {
+		return fmt.Errorf("--max-keyframes can't be negative")
+	}
+	if dedupeDist < 0 || dedupeDist > 64 {
+		return fmt.Errorf("--dedupe-distance must be between 0 and 64")
+	}
+
+	if fps <= 0 {
+		return fmt.Errorf("--fps must be positive")
+	}
+	if sceneScore <= 0 || sceneScore >= 1 {
+		return fmt.Errorf("--scene-threshold must be between 0 and 1")
+	}
+
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+
+	return nil
+}
+
+// resolveModel sets modelPath to the whisper model for the transcription
+// options. A --model file is used as given; otherwise --model-name picks from
+// the registry, preferring its English-only variant for English speech.
+func resolveModel() error {
+	if noTranscript {
+		return nil
+	}
+
+	multilingual := transcribeOpts.Multilingual()
+	option := "--translate"
+	if !transcribeOpts.Translate {
+		option = "--language " + transcribeOpts.Language
+	}
+
+	if diarize {
+		if err := resolveTurnsModel(); err != nil {
+			return err
 		}
+	}
 
-		// Step: Extract audio
-		step := ui.NewStep("Extracting audio")
-		audioPath, err := audio.ExtractAudioTrack(inputPath, duration, step.Update)
-		if err != nil {
-			step.Error("Audio extraction failed")
-			return fmt.Errorf("audio extraction failed: %w", err)
+	if modelPath != "" {
+		if multilingual && audio.IsEnglishOnlyModel(modelPath) {
+			return fmt.Errorf("%s needs a multilingual model, but %s is English-only", option, filepath.Base(modelPath))
 		}
-		step.Complete("Audio extracted")
+		return nil
+	}
+
+	model, err := audio.SelectModel(modelName, multilingual)
+	if err != nil {
+		return fmt.Errorf("--model-name: %w", err)
+	}
+	dir, err := audio.ModelDir()
+	if err != nil {
+		return err
+	}
+	modelPath = filepath.Join(dir, model.File)
+
+	// Earlier versions saved the English-only base model as ggml-base.bin
+	if multilingual && audio.IsEnglishOnlyModel(modelPath) {
+		return fmt.Errorf("%s needs a multilingual model, but %s holds an English-only one: run \"memorex models pull %s\" to replace it",
+			option, modelPath, model.Name)
+	}
+	return nil
+}
+
+// resolveTurnsModel sets turnsModelPath to the tinydiarize model --diarize
+// uses for audio that isn't stereo: --model if it is one, otherwise the
+// registry's, noting in turnsOverride the model that was asked for instead
+func resolveTurnsModel() error {
+	if modelPath != "" && strings.Contains(filepath.Base(modelPath), "tdrz") {
+		turnsModelPath = modelPath
+		return nil
+	}
+	switch {
+	case modelPath != "":
+		turnsOverride = "--model " + filepath.Base(modelPath)
+	case modelName != audio.DefaultModelName:
+		turnsOverride = "--model-name " + modelName
+	}
+	model, err := audio.LookupModel(audio.TurnsModelName)
+	if err != nil {
+		return err
+	}
+	dir, err := audio.ModelDir()
+	if err != nil {
+		return err
+	}
+	turnsModelPath = filepath.Join(dir, model.File)
+	return nil
+}
 
-		// Step: Transcribe
-		step = ui.NewStep("Transcribing")
-		segments, err = audio.TranscribeAudio(audioPath, modelPath, step.Update)
-		// Clean up audio file
-		_ = os.Remove(audioPath)
+// parseTimeRanges combines --start, --end and --range into sorted,
+// non-overlapping ranges, or nil to process the whole input
+func parseTimeRanges() ([]video.TimeRange, error) {
+	var parsed []video.TimeRange
+	for _, spec := range ranges {
+		r, err := video.ParseTimeRange(spec)
 		if err != nil {
-			step.Error("Transcription failed")
-			return fmt.Errorf("transcription failed: %w", err)
+			return nil, fmt.Errorf("--range: %w", err)
 		}
-		step.Complete(fmt.Sprintf("Transcribed %d segments", len(segments)))
+		parsed = append(parsed, r)
 	}
 
-	// Step: Generate markdown
-	step := ui.NewStep("Generating markdown")
-	result := output.Result{
-		InputPath:   inputPath,
-		Duration:    duration,
-		TotalFrames: totalFrames,
-		Keyframes:   convertKeyframes(keyframes, framesDir),
-		Segments:    convertSegments(segments),
+	if startAt != "" || endAt != "" {
+		var r video.TimeRange
+		var err error
+		if startAt != "" {
+			if r.Start, err = video.ParseTimestamp(startAt); err != nil {
+				return nil, fmt.Errorf("--start: %w", err)
+			}
+		}
+		if endAt != "" {
+			if r.End, err = video.ParseTimestamp(endAt); err != nil {
+				return nil, fmt.Errorf("--end: %w", err)
+			}
+			if r.End <= r.Start {
+				return nil, fmt.Errorf("--end must be after --start")
+			}
+		}
+		parsed = append(parsed, r)
 	}
 
-	if err := output.WriteMarkdown(outputPath, result); err != nil {
-		step.Error("Failed to write output")
-		return fmt.Errorf("failed to write output: %w", err)
-	}
-	step.Complete("Markdown generated")
+	return video.MergeRanges(parsed), nil
+}
 
-	// Print summary
-	fmt.Fprintln(os.Stderr)
-	ui.PrintSuccess(fmt.Sprintf("Output: %s", outputPath))
-	if !noFrames {
-		ui.PrintInfo(fmt.Sprintf("Frames: %s/", framesDir))
+// runSingle processes one file with full progress output
+func runSingle(inputPath string) error {
+	path := outputPath
+	if path == "" {
+		path = defaultOutputPath(inputPath)
 	}
 
-	tokenEstimate := output.EstimateTokens(result)
-	ui.PrintInfo(fmt.Sprintf("Estimated tokens: ~%d", tokenEstimate))
+	ui.PrintHeader("memorex")
+	ui.PrintInfo(fmt.Sprintf("Processing: %s", output.InputName(inputPath)))
 
-	return nil
+	_, err := processFile(&job{inputPath: inputPath, outputPath: path})
+	return err
 }
 
 func formatDuration(d time.Duration) string {
@@ -199,26 +415,7 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%ds", s)
 }
 
-func convertKeyframes(keyframes []video.Keyframe, framesDir string) []output.Keyframe {
-	result := make([]output.Keyframe, len(keyframes))
-	for i, kf := range keyframes {
-		result[i] = output.Keyframe{
-			Index:     kf.Index,
-			Timestamp: kf.Timestamp,
-			Path:      filepath.Join(framesDir, fmt.Sprintf("frame_%04d.jpg", kf.Index)),
-		}
-	}
-	return result
-}
-
-func convertSegments(segments []audio.Segment) []output.Segment {
-	result := make([]output.Segment, len(segments))
-	for i, seg := range segments {
-		result[i] = output.Segment{
-			Start: seg.Start,
-			End:   seg.End,
-			Text:  seg.Text,
-		}
-	}
-	return result
+// seconds converts a flag value in seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
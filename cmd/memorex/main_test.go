@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jayzes/memorex/internal/audio"
+)
+
+func TestValidateFlagsMaxTokens(t *testing.T) {
+	oldFormat, oldLayout, oldTokens := format, layout, maxTokens
+	t.Cleanup(func() { format, layout, maxTokens = oldFormat, oldLayout, oldTokens })
+	format, layout, maxTokens = formatMarkdown, "standard", -1
+
+	if err := validateFlags(); err == nil || !strings.Contains(err.Error(), "--max-tokens") {
+		t.Errorf("Expected a negative --max-tokens to be rejected, got %v", err)
+	}
+}
+
+func TestValidateFlagsCompareSpacing(t *testing.T) {
+	oldFormat, oldLayout, oldSampler, oldCompare := format, layout, sampler, compare
+	oldMin, oldMax, oldCap := minInterval, maxInterval, maxKeyframes
+	t.Cleanup(func() {
+		format, layout, sampler, compare = oldFormat, oldLayout, oldSampler, oldCompare
+		minInterval, maxInterval, maxKeyframes = oldMin, oldMax, oldCap
+	})
+	format, layout, sampler = formatMarkdown, "standard", "fps"
+
+	tests := []struct {
+		compare                  string
+		minInterval, maxInterval float64
+		maxKeyframes             int
+	}{
+		{"keyframe", 3, 0, 0},
+		{"both", 0, 30, 0},
+		{"keyframe", 0, 0, 10},
+	}
+	for _, tt := range tests {
+		compare, minInterval, maxInterval, maxKeyframes = tt.compare, tt.minInterval, tt.maxInterval, tt.maxKeyframes
+		if err := validateFlags(); err == nil || !strings.Contains(err.Error(), "can't be combined") {
+			t.Errorf("Expected --compare %s with --min-interval %g --max-interval %g --max-keyframes %d to be rejected, got %v",
+				tt.compare, tt.minInterval, tt.maxInterval, tt.maxKeyframes, err)
+		}
+	}
+
+	// Consecutive comparison takes the spacing flags, so validation moves on
+	compare = "consecutive"
+	if err := validateFlags(); err != nil && strings.Contains(err.Error(), "can't be combined") {
+		t.Errorf("Expected --compare consecutive to allow --max-keyframes, got %v", err)
+	}
+}
+
+func TestResolveTurnsModel(t *testing.T) {
+	t.Setenv(audio.ModelDirEnv, "/models")
+	oldPath, oldName := modelPath, modelName
+	t.Cleanup(func() {
+		modelPath, modelName = oldPath, oldName
+		turnsModelPath, turnsOverride = "", ""
+	})
+
+	tests := []struct {
+		modelPath    string
+		modelName    string
+		wantPath     string
+		wantOverride string
+	}{
+		{"", audio.DefaultModelName, "/models/ggml-small.en-tdrz.bin", ""},
+		{"", "medium", "/models/ggml-small.en-tdrz.bin", "--model-name medium"},
+		{"/srv/ggml-large-v3.bin", audio.DefaultModelName, "/models/ggml-small.en-tdrz.bin", "--model ggml-large-v3.bin"},
+		{"/srv/ggml-custom-tdrz.bin", audio.DefaultModelName, "/srv/ggml-custom-tdrz.bin", ""},
+	}
+	for _, tt := range tests {
+		modelPath, modelName = tt.modelPath, tt.modelName
+		turnsModelPath, turnsOverride = "", ""
+		if err := resolveTurnsModel(); err != nil {
+			t.Fatalf("resolveTurnsModel failed: %v", err)
+		}
+		if turnsModelPath != tt.wantPath || turnsOverride != tt.wantOverride {
+			t.Errorf("With --model %q --model-name %q: got %q, override %q, want %q, override %q",
+				tt.modelPath, tt.modelName, turnsModelPath, turnsOverride, tt.wantPath, tt.wantOverride)
+		}
+	}
+}
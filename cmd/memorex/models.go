@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jayzes/memorex/internal/audio"
+	"github.com/jayzes/memorex/internal/ui"
+)
+
+// newModelsCmd returns the "models" command, which manages downloaded
+// whisper models
+func newModelsCmd() *cobra.Command {
+	modelsCmd := &cobra.Command{
+		Use:   "models",
+		Short: "List, download and remove whisper models",
+		Long: `Manage the whisper models used for transcription. Models are kept in
+$MEMOREX_MODEL_DIR, or ~/.cache/whisper if it isn't set.`,
+	}
+
+	modelsCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the available models and which are installed",
+		Args:  cobra.NoArgs,
+		RunE:  runModelsList,
+	})
+	modelsCmd.AddCommand(&cobra.Command{
+		Use:   "pull <name>...",
+		Short: "Download models, resuming interrupted downloads",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runModelsPull,
+	})
+	modelsCmd.AddCommand(&cobra.Command{
+		Use:   "rm <name>...",
+		Short: "Remove downloaded models",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runModelsRemove,
+	})
+
+	return modelsCmd
+}
+
+func runModelsList(_ *cobra.Command, _ []string) error {
+	dir, err := audio.ModelDir()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tSIZE\tSUPPORTS\tSTATUS")
+	for _, m := range audio.Models() {
+		languages := "multilingual"
+		if m.EnglishOnly {
+			languages = "English"
+		}
+		if m.SpeakerTurns {
+			languages += ", speaker turns"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Name, formatBytes(m.Size), languages,
+			modelStatus(audio.CheckModel(m, filepath.Join(dir, m.File))))
+	}
+	_ = tw.Flush()
+
+	fmt.Printf("\nModels are kept in %s\n", dir)
+	return nil
+}
+
+// modelStatus describes a model's state for models list
+func modelStatus(state audio.ModelState) string {
+	switch {
+	case state.Installed && state.Verified:
+		return "installed"
+	case state.Installed:
+		return "installed (unverified)"
+	case state.Partial > 0:
+		return fmt.Sprintf("partial (%s)", formatBytes(state.Partial))
+	default:
+		return "-"
+	}
+}
+
+func runModelsPull(_ *cobra.Command, args []string) error {
+	models, dir, err := lookupModels(args)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range models {
+		path := filepath.Join(dir, m.File)
+		// Unverified files, such as ones from older versions, are replaced
+		if state := audio.CheckModel(m, path); state.Installed && state.Verified {
+			ui.PrintSuccess(fmt.Sprintf("%s is already installed", m.Name))
+			continue
+		}
+
+		step := ui.NewStep(fmt.Sprintf("Downloading %s", m.Name))
+		if err := audio.PullModel(m, path, step.Update); err != nil {
+			step.Error(fmt.Sprintf("Downloading %s failed", m.Name))
+			return fmt.Errorf("failed to download %s: %w", m.Name, err)
+		}
+		step.Complete(fmt.Sprintf("%s downloaded to %s", m.Name, path))
+	}
+	return nil
+}
+
+func runModelsRemove(_ *cobra.Command, args []string) error {
+	models, dir, err := lookupModels(args)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range models {
+		path := filepath.Join(dir, m.File)
+		if state := audio.CheckModel(m, path); !state.Installed && state.Partial == 0 {
+			ui.PrintWarning(fmt.Sprintf("%s is not installed", m.Name))
+			continue
+		}
+		if err := audio.RemoveModel(path); err != nil {
+			return err
+		}
+		ui.PrintSuccess(fmt.Sprintf("Removed %s", m.Name))
+	}
+	return nil
+}
+
+// lookupModels resolves model names against the registry, failing before
+// anything is changed if one is unknown
+func lookupModels(names []string) ([]audio.Model, string, error) {
+	models := make([]audio.Model, len(names))
+	for i, name := range names {
+		m, err := audio.LookupModel(name)
+		if err != nil {
+			return nil, "", err
+		}
+		models[i] = m
+	}
+
+	dir, err := audio.ModelDir()
+	if err != nil {
+		return nil, "", err
+	}
+	return models, dir, nil
+}
+
+// formatBytes formats a size in MB or GB
+func formatBytes(n int64) string {
+	if n >= 1_000_000_000 {
+		return fmt.Sprintf("%.1f GB", float64(n)/1e9)
+	}
+	return fmt.Sprintf("%d MB", (n+500_000)/1_000_000)
+}
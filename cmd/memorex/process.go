@@ -0,0 +1,530 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jayzes/memorex/internal/audio"
+	"github.com/jayzes/memorex/internal/output"
+	"github.com/jayzes/memorex/internal/ui"
+	"github.com/jayzes/memorex/internal/video"
+)
+
+// job is a single input file to process
+type job struct {
+	// inputPath is the input as given: a path, an http(s) URL or "-" for
+	// standard input
+	inputPath string
+	// mediaPath is what ffmpeg reads, set by processFile
+	mediaPath  string
+	outputPath string
+	// diarize is how speakers are told apart in this input, set by
+	// processFile when --diarize is given
+	diarize audio.Diarization
+	// quiet suppresses step progress and informational messages, for files
+	// processed in the background as part of a batch. Warnings are collected
+	// instead of printed.
+	quiet    bool
+	warnings []string
+}
+
+// fileSummary reports what processing a single file produced
+type fileSummary struct {
+	inputPath  string
+	outputPath string
+	duration   time.Duration
+	keyframes  int
+	segments   int
+	tokens     int
+}
+
+func (j *job) step(name string) *ui.Step {
+	if j.quiet {
+		return ui.NewQuietStep(name)
+	}
+	return ui.NewStep(name)
+}
+
+func (j *job) info(message string) {
+	if !j.quiet {
+		ui.PrintInfo(message)
+	}
+}
+
+func (j *job) warn(message string) {
+	if j.quiet {
+		j.warnings = append(j.warnings, message)
+		return
+	}
+	ui.PrintWarning(message)
+}
+
+// defaultOutputPath returns <input>_memorex.md (or .json) next to a local
+// input, or in the current directory for URLs and standard input
+func defaultOutputPath(inputPath string) string {
+	base := outputBase(inputPath)
+	if format == formatJSON {
+		return base + "_memorex.json"
+	}
+	return base + "_memorex.md"
+}
+
+// processFile runs the full pipeline for one input file: frame extraction,
+// keyframe detection, transcription and output generation
+func processFile(j *job) (fileSummary, error) {
+	summary := fileSummary{inputPath: j.inputPath, outputPath: j.outputPath}
+
+	mediaPath, closeMedia, err := j.openMedia()
+	if err != nil {
+		return summary, err
+	}
+	defer closeMedia()
+	j.mediaPath = mediaPath
+
+	// Probe the input's streams, to know which stages apply and the frame size
+	media, err := video.Probe(j.mediaPath)
+	if err != nil {
+		return summary, fmt.Errorf("failed to probe input: %w", err)
+	}
+	duration := media.Duration
+	mediaInfo := convertMedia(media)
+	if noChapters {
+		mediaInfo.Chapters = nil
+	}
+	j.info(fmt.Sprintf("Duration: %s", formatDuration(duration)))
+
+	extractFrames, transcribeAudio := !noFrames, !noTranscript
+	if extractFrames && media.Video == nil {
+		j.info("No video stream, skipping frames")
+		extractFrames = false
+	}
+	if transcribeAudio && media.Audio == nil {
+		j.info("No audio stream, skipping transcript")
+		transcribeAudio = false
+	}
+	if diarize && transcribeAudio {
+		j.chooseDiarization(media.Audio)
+	}
+	summary.duration = duration
+
+	// Create frames directory
+	framesDir := strings.TrimSuffix(j.outputPath, filepath.Ext(j.outputPath)) + "_frames"
+	if extractFrames {
+		if err := os.MkdirAll(framesDir, 0o750); err != nil {
+			return summary, fmt.Errorf("failed to create frames directory: %w", err)
+		}
+	}
+
+	ranges, err := resolveRanges(timeRanges, duration)
+	if err != nil {
+		return summary, err
+	}
+	if len(ranges) > 0 {
+		spans := make([]string, len(ranges))
+		for i, r := range ranges {
+			spans[i] = formatDuration(r.Start) + " to " + formatDuration(r.End)
+		}
+		j.info(fmt.Sprintf("Processing %s", strings.Join(spans, ", ")))
+	}
+	if !j.quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	var keyframes []video.Keyframe
+	var totalFrames int
+	var frameWidth, frameHeight int
+	saveScale := scale
+
+	// Intermediate results are cached by input content and stage parameters
+	entry := j.openCache()
+
+	// Extract and process frames
+	if extractFrames {
+		// Step 1: Sample and score frames straight from ffmpeg
+		step := j.step("Detecting keyframes")
+		frames, scores, cached, err := j.scoreFrames(entry, media.Video, duration, step.Update)
+		if err != nil {
+			step.Error("Keyframe detection failed")
+			return summary, fmt.Errorf("keyframe detection failed: %w", err)
+		}
+		totalFrames = len(frames)
+		keyframes = video.SelectKeyframesWithOptions(frames, scores, video.SelectOptions{
+			Threshold:    threshold,
+			MinInterval:  seconds(minInterval),
+			MaxInterval:  seconds(maxInterval),
+			MaxKeyframes: maxKeyframes,
+		})
+		keyframes = video.RefineKeyframes(frames, keyframes, video.RefineOptions{
+			Choice: keyframeChoice,
+			Window: settleWindow,
+			// Settled means closer to identical than to a new keyframe
+			Settle: (1 + threshold) / 2,
+		})
+		if dedupe {
+			keyframes = video.DedupeKeyframes(frames, keyframes, dedupeDist)
+		}
+		if cached {
+			step.Complete(fmt.Sprintf("Found %d keyframes in %d frames (cached scores)", len(keyframes), totalFrames))
+		} else {
+			step.Complete(fmt.Sprintf("Found %d keyframes in %d frames", len(keyframes), totalFrames))
+		}
+
+		if repeats := countRepeats(keyframes); repeats > 0 {
+			j.info(fmt.Sprintf("%d keyframes repeat an earlier one", repeats))
+		}
+
+		// Step 2: Extract only the keyframes at full resolution
+		cleanup, err := j.extractKeyframeImages(entry, frames, keyframes, duration)
+		defer cleanup()
+		if err != nil {
+			return summary, err
+		}
+
+		if len(keyframes) > 0 {
+			frameWidth, frameHeight, err = video.FrameSize(keyframes[0].Path)
+			if err != nil {
+				j.warn(fmt.Sprintf("Could not read frame size: %v", err))
+			}
+		}
+
+		// Step 3: Save keyframes (deferred until the transcript size is known
+		// when fitting a token budget)
+		if maxTokens == 0 {
+			if err := j.saveKeyframes(keyframes, framesDir, saveScale); err != nil {
+				return summary, err
+			}
+		}
+	}
+
+	var transcript audio.Transcript
+
+	// Transcribe audio
+	if transcribeAudio {
+		if transcript, err = j.transcribe(entry, duration); err != nil {
+			return summary, err
+		}
+		if transcribeOpts.Language == audio.LanguageAuto && transcript.Language != "" {
+			j.info(fmt.Sprintf("Detected language: %s", transcript.Language))
+		}
+	}
+	segments := transcript.Segments
+
+	// Fit keyframes into the token budget now that the transcript is known
+	if extractFrames && maxTokens > 0 {
+		text := output.Result{Segments: convertSegments(segments), Media: mediaInfo}
+		if j.diarize != audio.DiarizeNone {
+			text.Speakers = speakers
+		}
+		keyframes, saveScale = j.applyTokenBudget(keyframes, text, frameWidth, frameHeight)
+		if err := j.saveKeyframes(keyframes, framesDir, saveScale); err != nil {
+			return summary, err
+		}
+	}
+
+	// Step: Generate output
+	formatName := "Markdown"
+	if format == formatJSON {
+		formatName = "JSON"
+	}
+	step := j.step("Generating output")
+	result := output.Result{
+		InputPath:     j.inputPath,
+		Duration:      duration,
+		TotalFrames:   totalFrames,
+		Keyframes:     convertKeyframes(keyframes, framesDir),
+		Segments:      convertSegments(segments),
+		Layout:        markdownLayout,
+		Ranges:        ranges,
+		Media:         mediaInfo,
+		Language:      transcript.Language,
+		LowConfidence: lowConfidence,
+	}
+	if j.diarize != audio.DiarizeNone {
+		result.Speakers = speakers
+	}
+	if transcript.Language != "" {
+		result.LanguageDetected = transcribeOpts.Language == audio.LanguageAuto
+		result.Translated = transcribeOpts.Translate
+	}
+
+	if err := writeOutput(j.outputPath, result); err != nil {
+		step.Error("Failed to write output")
+		return summary, fmt.Errorf("failed to write output: %w", err)
+	}
+	step.Complete(formatName + " generated")
+
+	subtitlePath := ""
+	if subtitleFormat != "" {
+		subtitlePath = output.SubtitlePath(j.outputPath, subtitleFormat)
+		err := output.WriteSubtitles(subtitlePath, result.Segments, subtitleFormat, output.DefaultSubtitleOptions())
+		if err != nil {
+			return summary, fmt.Errorf("failed to write subtitles: %w", err)
+		}
+	}
+
+	tokens := output.EstimateTokenBreakdown(result)
+	summary.keyframes = len(result.Keyframes)
+	summary.segments = len(result.Segments)
+	summary.tokens = tokens.Total()
+
+	if j.quiet {
+		return summary, nil
+	}
+
+	// Print summary
+	fmt.Fprintln(os.Stderr)
+	ui.PrintSuccess(fmt.Sprintf("Output: %s", j.outputPath))
+	if jsonSidecar && format == formatMarkdown {
+		ui.PrintInfo(fmt.Sprintf("JSON: %s", output.JSONSidecarPath(j.outputPath)))
+	}
+	if subtitlePath != "" {
+		ui.PrintInfo(fmt.Sprintf("Subtitles: %s", subtitlePath))
+	}
+	if extractFrames {
+		ui.PrintInfo(fmt.Sprintf("Frames: %s/", framesDir))
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Estimated tokens: ~%d", tokens.Total()))
+	ui.PrintInfo(fmt.Sprintf("  metadata ~%d, transcript ~%d, images ~%d (%d keyframes)",
+		tokens.Metadata, tokens.Transcript, tokens.Images, len(result.Keyframes)))
+
+	return summary, nil
+}
+
+// chooseDiarization picks how to tell speakers apart: by channel for stereo
+// audio, otherwise by speaker turns, which needs English speech
+func (j *job) chooseDiarization(stream *video.AudioStream) {
+	switch {
+	case stream.Channels == 2:
+		j.diarize = audio.DiarizeStereo
+		j.info("Labeling speakers by stereo channel")
+	case transcribeOpts.Multilingual():
+		j.warn("Speakers in audio that isn't stereo can only be told apart in English; transcribing without speakers")
+	default:
+		j.diarize = audio.DiarizeTurns
+		j.info("Labeling speaker turns")
+		if turnsOverride != "" {
+			j.warn(fmt.Sprintf("Speaker turns need the tinydiarize model: transcribing with %s instead of %s",
+				filepath.Base(turnsModelPath), turnsOverride))
+		}
+	}
+}
+
+// modelMu keeps batch workers from downloading the same model at once
+var modelMu sync.Mutex
+
+// ensureModel downloads the whisper model at path if it is not already
+// present. Only models in the registry can be downloaded.
+func (j *job) ensureModel(path string) error {
+	modelMu.Lock()
+	defer modelMu.Unlock()
+
+	if audio.ModelExists(path) {
+		return nil
+	}
+	model, ok := audio.ModelForFile(path)
+	if !ok {
+		return fmt.Errorf("whisper model not found at %s", path)
+	}
+
+	step := j.step(fmt.Sprintf("Downloading whisper model %s", model.Name))
+	if err := audio.PullModel(model, path, step.Update); err != nil {
+		step.Error("Model download failed")
+		return fmt.Errorf("failed to download model: %w", err)
+	}
+	step.Complete(fmt.Sprintf("Model %s downloaded", model.Name))
+	return nil
+}
+
+// saveKeyframes runs the keyframe saving step
+func (j *job) saveKeyframes(keyframes []video.Keyframe, framesDir string, saveScale float64) error {
+	step := j.step("Saving keyframes")
+	if err := video.SaveKeyframes(keyframes, framesDir, quality, saveScale, step.Update); err != nil {
+		step.Error("Failed to save keyframes")
+		return fmt.Errorf("failed to save keyframes: %w", err)
+	}
+	step.Complete("Keyframes saved")
+	return nil
+}
+
+// applyTokenBudget picks the frame scale and the keyframes to keep so the
+// estimated output fits within --max-tokens, and reports what was changed.
+// text is the output without its keyframes: its transcript and metadata,
+// such as chapters, are budgeted first. Only keyframes with their own image
+// are budgeted; repeats are kept as long as the keyframe they repeat is.
+func (j *job) applyTokenBudget(keyframes []video.Keyframe, text output.Result, width, height int) ([]video.Keyframe, float64) {
+	textTokens := output.EstimateTokens(text)
+
+	var originals []int
+	var dissimilarity []float64
+	for i, kf := range keyframes {
+		if kf.DuplicateOf == 0 {
+			originals = append(originals, i)
+			dissimilarity = append(dissimilarity, 1-kf.Similarity)
+		}
+	}
+
+	plan := output.PlanBudget(maxTokens, textTokens, dissimilarity, width, height, scale)
+
+	if plan.Scale != scale {
+		j.info(fmt.Sprintf("Token budget: scale reduced from %.2f to %.2f", scale, plan.Scale))
+	}
+	if len(plan.Dropped) > 0 {
+		timestamps := make([]string, len(plan.Dropped))
+		for i, idx := range plan.Dropped {
+			timestamps[i] = formatDuration(keyframes[originals[idx]].Timestamp)
+		}
+		j.warn(fmt.Sprintf("Token budget: dropped %d of %d keyframes (at %s)",
+			len(plan.Dropped), len(originals), strings.Join(timestamps, ", ")))
+	}
+	if plan.Estimate > maxTokens {
+		j.warn(fmt.Sprintf("Token budget: transcript and metadata alone are ~%d tokens, over the %d budget", textTokens, maxTokens))
+	}
+
+	keep := make(map[int]bool, len(plan.Keep))
+	for _, idx := range plan.Keep {
+		keep[keyframes[originals[idx]].Index] = true
+	}
+	var kept []video.Keyframe
+	for _, kf := range keyframes {
+		if keep[kf.Index] || keep[kf.DuplicateOf] {
+			kept = append(kept, kf)
+		}
+	}
+	return kept, plan.Scale
+}
+
+// countRepeats returns how many keyframes repeat an earlier one
+func countRepeats(keyframes []video.Keyframe) int {
+	n := 0
+	for _, kf := range keyframes {
+		if kf.DuplicateOf != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// writeOutput writes the result in the selected format, plus the JSON
+// sidecar if requested
+func writeOutput(path string, result output.Result) error {
+	if format == formatJSON {
+		return output.WriteJSON(path, result)
+	}
+
+	if err := output.WriteMarkdown(path, result); err != nil {
+		return err
+	}
+
+	if jsonSidecar {
+		return output.WriteJSON(output.JSONSidecarPath(path), result)
+	}
+	return nil
+}
+
+// resolveRanges checks the selected time ranges against the input's
+// duration and fills in open ends. It returns nil if the whole input is
+// processed.
+func resolveRanges(ranges []video.TimeRange, duration time.Duration) ([]output.TimeRange, error) {
+	var resolved []output.TimeRange
+	for _, r := range ranges {
+		if duration > 0 && r.Start >= duration {
+			return nil, fmt.Errorf("time range starting at %s is past the end of the input (%s)",
+				formatDuration(r.Start), formatDuration(duration))
+		}
+		end := r.End
+		if end == 0 || (duration > 0 && end > duration) {
+			end = duration
+		}
+		resolved = append(resolved, output.TimeRange{Start: r.Start, End: end})
+	}
+	return resolved, nil
+}
+
+func convertKeyframes(keyframes []video.Keyframe, framesDir string) []output.Keyframe {
+	result := make([]output.Keyframe, len(keyframes))
+	for i, kf := range keyframes {
+		if kf.DuplicateOf != 0 {
+			// Repeats point at the image saved for the first occurrence
+			result[i] = output.Keyframe{
+				Index:          kf.Index,
+				Timestamp:      kf.Timestamp,
+				ImageTimestamp: kf.ImageTimestamp,
+				Path:           filepath.Join(framesDir, fmt.Sprintf("frame_%04d.jpg", kf.DuplicateOf)),
+				DuplicateOf:    kf.DuplicateOf,
+			}
+			continue
+		}
+
+		path := filepath.Join(framesDir, fmt.Sprintf("frame_%04d.jpg", kf.Index))
+		// Read the saved JPEG's real size for token estimation; on failure
+		// the estimate falls back to a conservative per-image cost
+		width, height, _ := video.FrameSize(path)
+		result[i] = output.Keyframe{
+			Index:          kf.Index,
+			Timestamp:      kf.Timestamp,
+			ImageTimestamp: kf.ImageTimestamp,
+			Path:           path,
+			Width:          width,
+			Height:         height,
+		}
+	}
+	return result
+}
+
+func convertMedia(info video.MediaInfo) *output.Media {
+	media := &output.Media{
+		Container:    info.Container,
+		Title:        info.Title,
+		CreationTime: info.CreationTime,
+		BitRate:      info.BitRate,
+	}
+	if v := info.Video; v != nil {
+		width, height := v.DisplaySize()
+		media.Video = &output.VideoStream{
+			Codec:     v.Codec,
+			Width:     width,
+			Height:    height,
+			FrameRate: v.FrameRate,
+			Rotation:  v.Rotation,
+		}
+	}
+	if a := info.Audio; a != nil {
+		media.Audio = &output.AudioStream{
+			Codec:         a.Codec,
+			Channels:      a.Channels,
+			ChannelLayout: a.ChannelLayout,
+			SampleRate:    a.SampleRate,
+		}
+	}
+	for _, c := range info.Chapters {
+		media.Chapters = append(media.Chapters, output.Chapter{Start: c.Start, End: c.End, Title: c.Title})
+	}
+	return media
+}
+
+func convertSegments(segments []audio.Segment) []output.Segment {
+	result := make([]output.Segment, len(segments))
+	for i, seg := range segments {
+		result[i] = output.Segment{
+			Start:      seg.Start,
+			End:        seg.End,
+			Text:       seg.Text,
+			Confidence: seg.Confidence,
+			Speaker:    seg.Speaker,
+		}
+		for _, w := range seg.Words {
+			result[i].Words = append(result[i].Words, output.Word{
+				Text:        w.Text,
+				Start:       w.Start,
+				End:         w.End,
+				Probability: w.Probability,
+			})
+		}
+	}
+	return result
+}
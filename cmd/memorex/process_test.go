@@ -0,0 +1,136 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jayzes/memorex/internal/audio"
+	"github.com/jayzes/memorex/internal/output"
+	"github.com/jayzes/memorex/internal/video"
+)
+
+// setBudget sets --max-tokens and --scale for the test
+func setBudget(t *testing.T, tokens int, s float64) {
+	t.Helper()
+	oldTokens, oldScale := maxTokens, scale
+	maxTokens, scale = tokens, s
+	t.Cleanup(func() { maxTokens, scale = oldTokens, oldScale })
+}
+
+func TestApplyTokenBudget(t *testing.T) {
+	keyframes := func() []video.Keyframe {
+		return []video.Keyframe{
+			{Index: 1},
+			{Index: 4, Similarity: 0.9, Timestamp: 20 * time.Second},
+			{Index: 6, Similarity: 0.2, Timestamp: 30 * time.Second},
+			{Index: 8, DuplicateOf: 4},
+			{Index: 9, DuplicateOf: 6},
+		}
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		setBudget(t, 10_000, 0.5)
+		j := &job{quiet: true}
+		kept, saveScale := j.applyTokenBudget(keyframes(), output.Result{}, 1920, 1080)
+		if len(kept) != 5 || saveScale != 0.5 || len(j.warnings) != 0 {
+			t.Errorf("Expected everything kept at 0.5, got %d at %.2f, warnings %q", len(kept), saveScale, j.warnings)
+		}
+	})
+
+	t.Run("drops the least dissimilar", func(t *testing.T) {
+		// Frames of unknown size cost 1000 tokens at any scale, so only two
+		// of the three images fit
+		setBudget(t, 2100, 0.5)
+		j := &job{quiet: true}
+		kept, saveScale := j.applyTokenBudget(keyframes(), output.Result{}, 0, 0)
+
+		var indices []int
+		for _, kf := range kept {
+			indices = append(indices, kf.Index)
+		}
+		// The first keyframe always stays, and repeats follow the keyframe
+		// they repeat
+		if !slices.Equal(indices, []int{1, 6, 9}) {
+			t.Errorf("Expected keyframes 1, 6 and 9 kept, got %v", indices)
+		}
+		if saveScale != output.MinBudgetScale {
+			t.Errorf("Expected the scale lowered to %.2f, got %.2f", output.MinBudgetScale, saveScale)
+		}
+		if len(j.warnings) != 1 || !strings.Contains(j.warnings[0], "dropped 1 of 3 keyframes (at 20s)") {
+			t.Errorf("Expected a warning about the dropped keyframe, got %q", j.warnings)
+		}
+	})
+
+	t.Run("over budget", func(t *testing.T) {
+		setBudget(t, 50, 0.5)
+		j := &job{quiet: true}
+		kept, _ := j.applyTokenBudget(keyframes(), output.Result{}, 0, 0)
+		if len(kept) != 0 {
+			t.Errorf("Expected every keyframe dropped, got %d", len(kept))
+		}
+		if len(j.warnings) != 2 || !strings.Contains(j.warnings[1], "~100 tokens, over the 50 budget") {
+			t.Errorf("Expected a warning that the text alone is over budget, got %q", j.warnings)
+		}
+	})
+}
+
+func TestApplyTokenBudgetCountsChapters(t *testing.T) {
+	// Frames of unknown size cost 1000 tokens each, on top of 100 for
+	// metadata
+	setBudget(t, 1150, 0.5)
+	keyframes := []video.Keyframe{{Index: 1}}
+
+	j := &job{quiet: true}
+	kept, _ := j.applyTokenBudget(keyframes, output.Result{}, 0, 0)
+	if len(kept) != 1 {
+		t.Fatalf("Expected the keyframe to fit without chapters, got %d", len(kept))
+	}
+
+	chapters := &output.Media{Chapters: make([]output.Chapter, 3)}
+	kept, _ = j.applyTokenBudget(keyframes, output.Result{Media: chapters}, 0, 0)
+	if len(kept) != 0 {
+		t.Errorf("Expected the chapters to push the keyframe over budget, got %d kept", len(kept))
+	}
+}
+
+func TestApplyTokenBudgetCountsSpeakers(t *testing.T) {
+	// "hello" labeled "Speaker 1" is 3 tokens
+	setBudget(t, 1104, 0.5)
+	keyframes := []video.Keyframe{{Index: 1}}
+	text := output.Result{Segments: []output.Segment{{Text: "hello", Speaker: 1}}}
+
+	j := &job{quiet: true}
+	if kept, _ := j.applyTokenBudget(keyframes, text, 0, 0); len(kept) != 1 {
+		t.Fatalf("Expected the keyframe to fit with the default label, got %d", len(kept))
+	}
+
+	// A longer name from --speakers costs more
+	text.Speakers = []string{"Dr Alice Jones"}
+	if kept, _ := j.applyTokenBudget(keyframes, text, 0, 0); len(kept) != 0 {
+		t.Errorf("Expected the speaker's name to push the keyframe over budget, got %d kept", len(kept))
+	}
+}
+
+func TestChooseDiarizationWarnsOfModelOverride(t *testing.T) {
+	oldPath, oldOverride := turnsModelPath, turnsOverride
+	turnsModelPath, turnsOverride = "/models/ggml-small.en-tdrz.bin", "--model-name medium"
+	t.Cleanup(func() { turnsModelPath, turnsOverride = oldPath, oldOverride })
+
+	j := &job{quiet: true}
+	j.chooseDiarization(&video.AudioStream{Channels: 1})
+	if j.diarize != audio.DiarizeTurns {
+		t.Fatalf("Expected speaker turns for mono audio, got %v", j.diarize)
+	}
+	if len(j.warnings) != 1 || !strings.Contains(j.warnings[0], "instead of --model-name medium") {
+		t.Errorf("Expected a warning that --model-name is replaced, got %q", j.warnings)
+	}
+
+	// Stereo audio keeps the chosen model
+	j = &job{quiet: true}
+	j.chooseDiarization(&video.AudioStream{Channels: 2})
+	if j.diarize != audio.DiarizeStereo || len(j.warnings) != 0 {
+		t.Errorf("Expected stereo labeling without warnings, got %v, %q", j.diarize, j.warnings)
+	}
+}
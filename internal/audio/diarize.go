@@ -0,0 +1,61 @@
+package audio
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// speakerTurnMarker is what whisper-cli prints after a segment when
+// tinydiarize finds the next one is another speaker
+const speakerTurnMarker = "[SPEAKER_TURN]"
+
+// printedSpeakerPattern matches the speaker whisper-cli prints before each
+// segment with stereo diarization, such as "(speaker 1)"
+var printedSpeakerPattern = regexp.MustCompile(`^\(speaker (\d+|\?)\)\s*`)
+
+// labelPrintedSpeakers sets the speakers of segments parsed from whisper-cli's
+// printed output, removing its speaker markers from the text
+func labelPrintedSpeakers(segments []Segment, mode Diarization) {
+	turns := make([]bool, len(segments))
+	for i := range segments {
+		seg := &segments[i]
+		if m := printedSpeakerPattern.FindStringSubmatch(seg.Text); m != nil {
+			seg.Text = seg.Text[len(m[0]):]
+			seg.Speaker = stereoSpeaker(m[1])
+		}
+		seg.Text, turns[i] = cutSpeakerTurn(seg.Text)
+	}
+	if mode == DiarizeTurns {
+		assignTurns(segments, turns)
+	}
+}
+
+// cutSpeakerTurn removes a trailing speaker turn marker from text, reporting
+// whether there was one
+func cutSpeakerTurn(text string) (string, bool) {
+	text, turn := strings.CutSuffix(text, speakerTurnMarker)
+	return strings.TrimSpace(text), turn
+}
+
+// stereoSpeaker converts whisper's stereo speaker id, "0" or "1" for the
+// louder channel or "?" when neither is, to a Speaker
+func stereoSpeaker(id string) int {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0
+	}
+	return n + 1
+}
+
+// assignTurns numbers speakers from 1, switching between Speaker 1 and 2
+// after each segment followed by a turn
+func assignTurns(segments []Segment, turnAfter []bool) {
+	speaker := 1
+	for i := range segments {
+		segments[i].Speaker = speaker
+		if turnAfter[i] {
+			speaker = 3 - speaker
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package audio
+
+import "testing"
+
+func TestLabelPrintedSpeakersStereo(t *testing.T) {
+	segments := parseWhisperOutput(`[00:00:00.000 --> 00:00:02.000]  (speaker 0) Hi, can you hear me?
+[00:00:02.000 --> 00:00:03.500]  (speaker 1) Yes, loud and clear.
+[00:00:03.500 --> 00:00:05.000]  (speaker ?) Great.
+`)
+	labelPrintedSpeakers(segments, DiarizeStereo)
+
+	want := []struct {
+		speaker int
+		text    string
+	}{
+		{1, "Hi, can you hear me?"},
+		{2, "Yes, loud and clear."},
+		{0, "Great."},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("Expected %d segments, got %+v", len(want), segments)
+	}
+	for i, w := range want {
+		if segments[i].Speaker != w.speaker || segments[i].Text != w.text {
+			t.Errorf("Segment %d = Speaker %d %q, want Speaker %d %q", i, segments[i].Speaker, segments[i].Text, w.speaker, w.text)
+		}
+	}
+}
+
+func TestLabelPrintedSpeakersTurns(t *testing.T) {
+	segments := parseWhisperOutput(`[00:00:00.000 --> 00:00:02.000]  So what brings you here? [SPEAKER_TURN]
+[00:00:02.000 --> 00:00:04.000]  I wanted to learn more.
+[00:00:04.000 --> 00:00:06.000]  About the project. [SPEAKER_TURN]
+[00:00:06.000 --> 00:00:07.000]  Great.
+`)
+	labelPrintedSpeakers(segments, DiarizeTurns)
+
+	wantSpeakers := []int{1, 2, 2, 1}
+	for i, want := range wantSpeakers {
+		if segments[i].Speaker != want {
+			t.Errorf("Segment %d is Speaker %d, want %d", i, segments[i].Speaker, want)
+		}
+	}
+	if segments[0].Text != "So what brings you here?" {
+		t.Errorf("Expected the turn marker to be removed, got %q", segments[0].Text)
+	}
+}
+
+func TestStereoSpeaker(t *testing.T) {
+	tests := map[string]int{"0": 1, "1": 2, "?": 0, "": 0}
+	for id, want := range tests {
+		if got := stereoSpeaker(id); got != want {
+			t.Errorf("stereoSpeaker(%q) = %d, want %d", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package audio
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// ModelBaseURL is where whisper.cpp's ggml models are downloaded from
+	ModelBaseURL = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/"
+	// ModelDirEnv is the environment variable that overrides where models
+	// are kept
+	ModelDirEnv = "MEMOREX_MODEL_DIR"
+	// DefaultModelName is the model used unless another is chosen
+	DefaultModelName = "base"
+	// TurnsModelName is the tinydiarize model, which marks speaker turns
+	TurnsModelName = "small.en-tdrz"
+)
+
+// tinyDiarizeBaseURL is where the tinydiarize models are published
+const tinyDiarizeBaseURL = "https://huggingface.co/akashmjn/tinydiarize-whisper.cpp/resolve/main/"
+
+// Model is a whisper.cpp model that memorex knows how to download
+type Model struct {
+	// Name is how the model is chosen, such as "base" or "small.en"
+	Name string
+	// File is the model's file name, upstream and on disk
+	File string
+	// Size is the approximate download size in bytes, for progress
+	Size int64
+	// SHA256 is the expected checksum of the file. Without it, downloads
+	// are checked against the checksum the server reports, and fail if
+	// there is none.
+	SHA256 string
+	// EnglishOnly models transcribe only English and can't translate
+	EnglishOnly bool
+	// SpeakerTurns models are tinydiarize models, which can mark where the
+	// speaker changes (DiarizeTurns)
+	SpeakerTurns bool
+	// BaseURL is where the model is downloaded from, if not ModelBaseURL
+	BaseURL string
+}
+
+// registry lists the models that can be downloaded by name. No checksums are
+// pinned yet, so downloads are checked against the one the server reports,
+// and a download without one isn't installed.
+var registry = []Model{
+	{Name: "tiny", File: "ggml-tiny.bin", Size: 78_000_000},
+	{Name: "tiny.en", File: "ggml-tiny.en.bin", Size: 78_000_000, EnglishOnly: true},
+	{Name: "base", File: "ggml-base.bin", Size: 148_000_000},
+	{Name: "base.en", File: "ggml-base.en.bin", Size: 148_000_000, EnglishOnly: true},
+	{Name: "small", File: "ggml-small.bin", Size: 488_000_000},
+	{Name: "small.en", File: "ggml-small.en.bin", Size: 488_000_000, EnglishOnly: true},
+	{Name: "medium", File: "ggml-medium.bin", Size: 1_530_000_000},
+	{Name: "medium.en", File: "ggml-medium.en.bin", Size: 1_530_000_000, EnglishOnly: true},
+	{Name: "large-v3", File: "ggml-large-v3.bin", Size: 3_100_000_000},
+	{Name: "large-v3-q5_0", File: "ggml-large-v3-q5_0.bin", Size: 1_080_000_000},
+	{Name: TurnsModelName, File: "ggml-small.en-tdrz.bin", Size: 488_000_000, EnglishOnly: true, SpeakerTurns: true, BaseURL: tinyDiarizeBaseURL},
+}
+
+// Models returns every model in the registry
+func Models() []Model {
+	return append([]Model(nil), registry...)
+}
+
+// LookupModel returns the registry model with the given name
+func LookupModel(name string) (Model, error) {
+	for _, m := range registry {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+
+	names := make([]string, len(registry))
+	for i, m := range registry {
+		names[i] = m.Name
+	}
+	return Model{}, fmt.Errorf("unknown model %q: must be one of %s", name, strings.Join(names, ", "))
+}
+
+// SelectModel returns the model to use for name: its English-only variant
+// when the speech is English and one exists, since those are more accurate
+// at the same size. A multilingual model is required otherwise.
+func SelectModel(name string, multilingual bool) (Model, error) {
+	m, err := LookupModel(name)
+	if err != nil {
+		return Model{}, err
+	}
+
+	if multilingual && m.EnglishOnly {
+		return Model{}, fmt.Errorf("model %s is English-only: use %s for other languages or translation",
+			m.Name, strings.TrimSuffix(m.Name, ".en"))
+	}
+	if !multilingual && !m.EnglishOnly {
+		if en, err := LookupModel(m.Name + ".en"); err == nil {
+			return en, nil
+		}
+	}
+	return m, nil
+}
+
+// ModelForFile returns the registry model stored under the file name of
+// modelPath, if any
+func ModelForFile(modelPath string) (Model, bool) {
+	name := filepath.Base(modelPath)
+	for _, m := range registry {
+		if m.File == name {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+// URL returns where the model is downloaded from
+func (m Model) URL() string {
+	if m.BaseURL != "" {
+		return m.BaseURL + m.File
+	}
+	return ModelBaseURL + m.File
+}
+
+// ModelDir returns where models are kept: $MEMOREX_MODEL_DIR if set,
+// otherwise ~/.cache/whisper, which other whisper.cpp tools share
+func ModelDir() (string, error) {
+	if dir := os.Getenv(ModelDirEnv); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, ".cache", "whisper"), nil
+}
+
+// ModelExists checks if the whisper model exists at the given path.
+func ModelExists(modelPath string) bool {
+	_, err := os.Stat(modelPath)
+	return err == nil
+}
+
+// ModelState describes a model's files on disk
+type ModelState struct {
+	Installed bool
+	// Verified is set when the installed file passed a checksum check on
+	// download
+	Verified bool
+	// Partial is the size of an interrupted download that PullModel will
+	// resume, 0 if there is none
+	Partial int64
+}
+
+// CheckModel reports what is on disk for model m at modelPath. If m has a
+// pinned checksum, the one recorded on download must match it to count as
+// verified.
+func CheckModel(m Model, modelPath string) ModelState {
+	var state ModelState
+	state.Installed = ModelExists(modelPath)
+	if state.Installed {
+		sum, err := os.ReadFile(checksumPath(modelPath))
+		state.Verified = err == nil && (m.SHA256 == "" || strings.EqualFold(strings.TrimSpace(string(sum)), m.SHA256))
+	}
+	if info, err := os.Stat(partialPath(modelPath)); err == nil {
+		state.Partial = info.Size()
+	}
+	return state
+}
+
+// PullModel downloads model m to modelPath. An interrupted download is
+// resumed with a Range request, and the file is checked against the model's
+// checksum before it is moved into place.
+func PullModel(m Model, modelPath string, onProgress ProgressFunc) error {
+	return downloadModel(m.URL(), modelPath, m.SHA256, m.Size, onProgress)
+}
+
+// RemoveModel deletes a model file along with its checksum and any partial
+// download
+func RemoveModel(modelPath string) error {
+	for _, path := range []string{modelPath, checksumPath(modelPath), partialPath(modelPath)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// IsEnglishOnlyModel reports whether a whisper model is English-only. The
+// model file's vocabulary size tells; if it can't be read, whisper.cpp's
+// naming (ggml-base.en.bin) is used instead.
+func IsEnglishOnlyModel(modelPath string) bool {
+	if vocab, err := modelVocabSize(modelPath); err == nil {
+		return vocab < multilingualVocabSize
+	}
+	return englishModelPattern.MatchString(filepath.Base(modelPath))
+}
+
+const (
+	// ggmlMagic starts every whisper.cpp model file ("ggml" little-endian)
+	ggmlMagic = 0x67676d6c
+	// multilingualVocabSize is the smallest vocabulary of a multilingual
+	// model; English-only models have 51864 tokens
+	multilingualVocabSize = 51865
+)
+
+// englishModelPattern matches names like ggml-base.en.bin and
+// ggml-small.en-q5_1.bin
+var englishModelPattern = regexp.MustCompile(`\.en([.-]|$)`)
+
+// modelVocabSize reads n_vocab, the first hyperparameter after the magic
+// number in a ggml model file
+func modelVocabSize(modelPath string) (int32, error) {
+	file, err := os.Open(modelPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var header struct {
+		Magic uint32
+		Vocab int32
+	}
+	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
+		return 0, fmt.Errorf("failed to read model header: %w", err)
+	}
+	if header.Magic != ggmlMagic {
+		return 0, fmt.Errorf("%s is not a ggml model", filepath.Base(modelPath))
+	}
+	return header.Vocab, nil
+}
+
+func partialPath(modelPath string) string {
+	return modelPath + ".part"
+}
+
+// checksumPath is where the SHA-256 of a verified download is recorded
+func checksumPath(modelPath string) string {
+	return modelPath + ".sha256"
+}
+
+// downloadModel downloads modelURL to modelPath, resuming from a partial
+// download if there is one. The file is verified against expectedSHA256 or,
+// if that is empty, the checksum the server reports. Without either it stays
+// a partial download; size is the fallback total for progress.
+func downloadModel(modelURL, modelPath, expectedSHA256 string, size int64, onProgress ProgressFunc) error {
+	// Create the directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(modelPath), 0o750); err != nil {
+		return fmt.Errorf("failed to create model directory: %w", err)
+	}
+
+	partPath := partialPath(modelPath)
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	// Hugging Face redirects to a CDN, reporting the checksum only on the
+	// redirect
+	var reported string
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if sum := linkedChecksum(req.Response.Header); sum != "" {
+				reported = sum
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, modelURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download model: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download model: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if sum := linkedChecksum(resp.Header); sum != "" {
+		reported = sum
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// The server ignored the range, so start over
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial download already has every byte; verify it below
+	default:
+		return fmt.Errorf("failed to download model: HTTP %d", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		total := size
+		if resp.ContentLength > 0 {
+			total = offset + resp.ContentLength
+		}
+		if err := appendDownload(partPath, flags, resp.Body, offset, total, onProgress); err != nil {
+			return err
+		}
+	}
+
+	expected := expectedSHA256
+	if expected == "" {
+		expected = reported
+	}
+	if expected == "" {
+		// Neither pinned nor reported, as when a 416 comes straight from
+		// the CDN. The download may still be good, so it is kept for the
+		// next pull to verify rather than fetched again.
+		return fmt.Errorf("downloaded model not verified: no SHA-256 to check it against; kept in %s for the next pull", partPath)
+	}
+	sum, err := hashFile(partPath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, expected) {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("downloaded model failed verification: SHA-256 is %s, expected %s", sum, expected)
+	}
+
+	// Move the download to its final location
+	if err := os.Rename(partPath, modelPath); err != nil {
+		return fmt.Errorf("failed to move model to final location: %w", err)
+	}
+	if err := os.WriteFile(checksumPath(modelPath), []byte(sum+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to record model checksum: %w", err)
+	}
+
+	return nil
+}
+
+// appendDownload copies body into the partial download at partPath, which
+// already holds offset bytes, reporting progress towards total
+func appendDownload(partPath string, flags int, body io.Reader, offset, total int64, onProgress ProgressFunc) error {
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open partial download: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	// Copy with progress tracking
+	written := offset
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err := file.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to write model: %w", err)
+			}
+			written += int64(n)
+			if onProgress != nil && total > 0 {
+				onProgress(min(float64(written)/float64(total), 1.0))
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			// Keep what was written so the next attempt resumes from it
+			return fmt.Errorf("failed to read model: %w", readErr)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close partial download: %w", err)
+	}
+	return nil
+}
+
+// linkedChecksum returns the SHA-256 Hugging Face reports in X-Linked-Etag
+// for files stored with Git LFS, or "" if the header isn't a SHA-256
+func linkedChecksum(h http.Header) string {
+	sum := strings.Trim(strings.TrimPrefix(h.Get("X-Linked-Etag"), "W/"), `"`)
+	if len(sum) != sha256.Size*2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return ""
+	}
+	return strings.ToLower(sum)
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open model: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash model: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
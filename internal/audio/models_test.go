@@ -0,0 +1,350 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupModel(t *testing.T) {
+	m, err := LookupModel("large-v3-q5_0")
+	if err != nil {
+		t.Fatalf("LookupModel failed: %v", err)
+	}
+	if m.File != "ggml-large-v3-q5_0.bin" || m.EnglishOnly {
+		t.Errorf("Unexpected model %+v", m)
+	}
+	if !strings.HasSuffix(m.URL(), "/ggml-large-v3-q5_0.bin") {
+		t.Errorf("Unexpected URL %s", m.URL())
+	}
+
+	tdrz, err := LookupModel(TurnsModelName)
+	if err != nil || !tdrz.SpeakerTurns || !strings.HasPrefix(tdrz.URL(), tinyDiarizeBaseURL) {
+		t.Errorf("Expected the tinydiarize model from its own repository, got %+v, %v", tdrz, err)
+	}
+
+	if _, err := LookupModel("huge"); err == nil || !strings.Contains(err.Error(), "tiny, tiny.en") {
+		t.Errorf("Expected an error listing the models, got %v", err)
+	}
+}
+
+func TestSelectModel(t *testing.T) {
+	tests := []struct {
+		name         string
+		multilingual bool
+		want         string
+		wantErr      bool
+	}{
+		{"base", false, "base.en", false},
+		{"base", true, "base", false},
+		{"small.en", false, "small.en", false},
+		{"small.en", true, "", true},
+		{"large-v3", false, "large-v3", false},
+		{"nope", false, "", true},
+	}
+	for _, tt := range tests {
+		m, err := SelectModel(tt.name, tt.multilingual)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("SelectModel(%q, %v) should fail", tt.name, tt.multilingual)
+			}
+			continue
+		}
+		if err != nil || m.Name != tt.want {
+			t.Errorf("SelectModel(%q, %v) = %q, %v, want %q", tt.name, tt.multilingual, m.Name, err, tt.want)
+		}
+	}
+}
+
+func TestModelDir(t *testing.T) {
+	t.Setenv(ModelDirEnv, "/srv/models")
+	if dir, err := ModelDir(); err != nil || dir != "/srv/models" {
+		t.Errorf("ModelDir() = %q, %v, want /srv/models", dir, err)
+	}
+
+	t.Setenv(ModelDirEnv, "")
+	t.Setenv("HOME", "/home/test")
+	if dir, err := ModelDir(); err != nil || dir != filepath.Join("/home/test", ".cache", "whisper") {
+		t.Errorf("ModelDir() = %q, %v, want ~/.cache/whisper", dir, err)
+	}
+}
+
+func TestIsEnglishOnlyModel(t *testing.T) {
+	tests := map[string]bool{
+		"/models/ggml-base.en.bin":        true,
+		"/models/ggml-small.en-q5_1.bin":  true,
+		"/models/ggml-base.bin":           false,
+		"/models/ggml-large-v3.bin":       false,
+		"/models/english/ggml-medium.bin": false,
+		"/models/ggml-tiny.en.bin":        true,
+		"/models/custom-finetune.en":      true,
+	}
+	for path, want := range tests {
+		if got := IsEnglishOnlyModel(path); got != want {
+			t.Errorf("IsEnglishOnlyModel(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestIsEnglishOnlyModelHeader(t *testing.T) {
+	dir := t.TempDir()
+	// The header wins over the name, which older versions got wrong
+	english := writeModelHeader(t, filepath.Join(dir, "ggml-base.bin"), 51864)
+	multilingual := writeModelHeader(t, filepath.Join(dir, "ggml-custom.en.bin"), 51866)
+
+	if !IsEnglishOnlyModel(english) {
+		t.Errorf("Expected a 51864-token model to be English-only")
+	}
+	if IsEnglishOnlyModel(multilingual) {
+		t.Errorf("Expected a 51866-token model to be multilingual")
+	}
+}
+
+func TestDownloadModel(t *testing.T) {
+	content := modelContent()
+	server := newModelServer(t, content, checksum(content))
+
+	modelPath := filepath.Join(t.TempDir(), "models", "ggml-test.bin")
+	var progress []float64
+	err := downloadModel(server.URL+"/ggml-test.bin", modelPath, "", 0, func(p float64) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatalf("downloadModel failed: %v", err)
+	}
+
+	assertModel(t, modelPath, content)
+	if len(progress) == 0 || progress[len(progress)-1] != 1.0 {
+		t.Errorf("Expected progress to reach 1.0, got %v", progress)
+	}
+	if state := CheckModel(Model{}, modelPath); !state.Installed || !state.Verified || state.Partial != 0 {
+		t.Errorf("Expected a verified install, got %+v", state)
+	}
+}
+
+func TestDownloadModelResume(t *testing.T) {
+	content := modelContent()
+	var ranges []string
+	server := newModelServer(t, content, checksum(content), func(r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+	})
+
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	if err := os.WriteFile(partialPath(modelPath), content[:1000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if state := CheckModel(Model{}, modelPath); state.Installed || state.Partial != 1000 {
+		t.Errorf("Expected a 1000-byte partial download, got %+v", state)
+	}
+
+	if err := downloadModel(server.URL+"/ggml-test.bin", modelPath, "", 0, nil); err != nil {
+		t.Fatalf("downloadModel failed: %v", err)
+	}
+
+	if len(ranges) != 1 || ranges[0] != "bytes=1000-" {
+		t.Errorf("Expected a request for bytes=1000-, got %q", ranges)
+	}
+	assertModel(t, modelPath, content)
+}
+
+func TestDownloadModelAlreadyComplete(t *testing.T) {
+	content := modelContent()
+	server := newModelServer(t, content, checksum(content))
+
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	if err := os.WriteFile(partialPath(modelPath), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadModel(server.URL+"/ggml-test.bin", modelPath, "", 0, nil); err != nil {
+		t.Fatalf("downloadModel failed: %v", err)
+	}
+	assertModel(t, modelPath, content)
+}
+
+func TestDownloadModelChecksumMismatch(t *testing.T) {
+	content := modelContent()
+	server := newModelServer(t, content, "")
+
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	err := downloadModel(server.URL+"/ggml-test.bin", modelPath, strings.Repeat("0", 64), 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "verification") {
+		t.Fatalf("Expected a verification error, got %v", err)
+	}
+	for _, path := range []string{modelPath, partialPath(modelPath)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", filepath.Base(path))
+		}
+	}
+}
+
+func TestDownloadModelRedirectChecksum(t *testing.T) {
+	content := modelContent()
+	cdn := newModelServer(t, content, "")
+	// The checksum is only reported on the redirect, as on Hugging Face
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Linked-Etag", `"`+strings.Repeat("f", 64)+`"`)
+		http.Redirect(w, r, cdn.URL+r.URL.Path, http.StatusFound)
+	}))
+	t.Cleanup(origin.Close)
+
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	err := downloadModel(origin.URL+"/ggml-test.bin", modelPath, "", 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "verification") {
+		t.Errorf("Expected the redirect's checksum to be checked, got %v", err)
+	}
+}
+
+func TestDownloadModelNoChecksum(t *testing.T) {
+	content := modelContent()
+	server := newModelServer(t, content, "")
+
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	err := downloadModel(server.URL+"/ggml-test.bin", modelPath, "", 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "no SHA-256") {
+		t.Fatalf("Expected a download without a checksum to fail, got %v", err)
+	}
+	// The download is kept for a later pull to verify
+	if state := CheckModel(Model{}, modelPath); state != (ModelState{Partial: int64(len(content))}) {
+		t.Errorf("Expected only the partial download, got %+v", state)
+	}
+}
+
+func TestDownloadModelAlreadyCompleteNoChecksum(t *testing.T) {
+	content := modelContent()
+	server := newModelServer(t, content, "")
+
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "ggml-test.bin")
+	if err := os.WriteFile(partialPath(modelPath), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The server answers 416 without a checksum, so the partial download
+	// can't be verified
+	err := downloadModel(server.URL+"/ggml-test.bin", modelPath, "", 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "no SHA-256") {
+		t.Fatalf("Expected an unverifiable download to fail, got %v", err)
+	}
+	if state := CheckModel(Model{}, modelPath); state != (ModelState{Partial: int64(len(content))}) {
+		t.Errorf("Expected the partial download kept and nothing installed, got %+v", state)
+	}
+
+	// A pinned checksum verifies it
+	pinned := filepath.Join(dir, "ggml-pinned.bin")
+	if err := os.WriteFile(partialPath(pinned), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadModel(server.URL+"/ggml-pinned.bin", pinned, checksum(content), 0, nil); err != nil {
+		t.Fatalf("downloadModel failed: %v", err)
+	}
+	assertModel(t, pinned, content)
+}
+
+func TestDownloadModelHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	err := downloadModel(server.URL+"/ggml-test.bin", modelPath, "", 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("Expected an HTTP 404 error, got %v", err)
+	}
+}
+
+func TestRemoveModel(t *testing.T) {
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	for _, path := range []string{modelPath, checksumPath(modelPath), partialPath(modelPath)} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RemoveModel(modelPath); err != nil {
+		t.Fatalf("RemoveModel failed: %v", err)
+	}
+	if state := CheckModel(Model{}, modelPath); state != (ModelState{}) {
+		t.Errorf("Expected nothing left, got %+v", state)
+	}
+	// Removing again is not an error
+	if err := RemoveModel(modelPath); err != nil {
+		t.Errorf("RemoveModel of a missing model failed: %v", err)
+	}
+}
+
+func TestCheckModelPinnedChecksum(t *testing.T) {
+	modelPath := filepath.Join(t.TempDir(), "ggml-test.bin")
+	if err := os.WriteFile(modelPath, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(checksumPath(modelPath), []byte("abc123\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !CheckModel(Model{SHA256: "ABC123"}, modelPath).Verified {
+		t.Errorf("Expected a matching checksum to verify")
+	}
+	if CheckModel(Model{SHA256: "def456"}, modelPath).Verified {
+		t.Errorf("Expected a different checksum not to verify")
+	}
+}
+
+// modelContent returns fake model bytes, large enough to take several reads
+func modelContent() []byte {
+	return bytes.Repeat([]byte("ggml model data "), 10_000)
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// newModelServer serves content at any path with Range support, reporting
+// sha in X-Linked-Etag if it is set
+func newModelServer(t *testing.T, content []byte, sha string, onRequest ...func(*http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, fn := range onRequest {
+			fn(r)
+		}
+		if sha != "" {
+			w.Header().Set("X-Linked-Etag", `"`+sha+`"`)
+		}
+		http.ServeContent(w, r, "model.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func assertModel(t *testing.T, modelPath string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(modelPath)
+	if err != nil {
+		t.Fatalf("Failed to read model: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Model has %d bytes, want %d matching", len(got), len(want))
+	}
+	if _, err := os.Stat(partialPath(modelPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial download to be gone")
+	}
+}
+
+// writeModelHeader writes the start of a ggml model with the given
+// vocabulary size
+func writeModelHeader(t *testing.T, path string, vocab int32) string {
+	t.Helper()
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(ggmlMagic))
+	_ = binary.Write(&buf, binary.LittleEndian, vocab)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -3,54 +3,147 @@ package audio
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const (
-	// DefaultModelURL is the URL to download the ggml-base.en model
-	DefaultModelURL = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-base.en.bin"
-	// ModelSize is the approximate size of the model for progress calculation
-	ModelSize = 148_000_000 // ~148MB
-)
-
 // Segment represents a transcribed audio segment with timing
 type Segment struct {
 	Start time.Duration
 	End   time.Duration
 	Text  string
+	// Confidence is the mean probability whisper gave the segment's tokens,
+	// from 0 to 1, or 0 if unknown
+	Confidence float64
+	// Words are the segment's words with their own timing, nil if whisper
+	// didn't report token timestamps
+	Words []Word
+	// Speaker numbers the voice speaking from 1, with diarization; 0 if
+	// unknown
+	Speaker int
 }
 
-// ProgressFunc is called with progress updates (0.0 to 1.0)
-type ProgressFunc func(percent float64)
+// Shift returns the segment with its times and its words' times moved by
+// offset, such as the start of the clip it was transcribed from
+func (s Segment) Shift(offset time.Duration) Segment {
+	s.Start += offset
+	s.End += offset
+	if s.Words != nil {
+		words := make([]Word, len(s.Words))
+		for i, w := range s.Words {
+			w.Start += offset
+			w.End += offset
+			words[i] = w
+		}
+		s.Words = words
+	}
+	return s
+}
+
+// Word is a word of a segment, made of one or more whisper tokens
+type Word struct {
+	Text  string
+	Start time.Duration
+	End   time.Duration
+	// Probability is the lowest probability of the word's tokens, from 0
+	// to 1: a word is as doubtful as its least certain part
+	Probability float64
+}
+
+// Transcript is the result of transcribing an audio file
+type Transcript struct {
+	Segments []Segment
+	// Language is the code of the spoken language: the one requested, or
+	// the one whisper detected with LanguageAuto
+	Language string
+}
+
+// LanguageAuto asks whisper to detect the spoken language
+const LanguageAuto = "auto"
+
+// TranscribeOptions controls transcription
+type TranscribeOptions struct {
+	// Language is the spoken language as a code such as "en" or "de", or
+	// LanguageAuto. Empty means English, whisper's default.
+	Language string
+	// Translate transcribes the speech translated to English
+	Translate bool
+	// Diarize labels segments by speaker
+	Diarize Diarization
+}
+
+// Diarization is how whisper tells speakers apart
+type Diarization string
+
+const (
+	// DiarizeNone leaves segments without speakers
+	DiarizeNone Diarization = ""
+	// DiarizeStereo compares the two channels of a stereo recording, such as
+	// a call with each side on its own channel (whisper's -di). The audio
+	// must be extracted with ExtractStereoClip.
+	DiarizeStereo Diarization = "stereo"
+	// DiarizeTurns marks where the speaker changes using a tinydiarize model
+	// (whisper's -tdrz). Turns alternate between Speaker 1 and 2, which suits
+	// two-person conversations; it can't tell a third voice apart.
+	DiarizeTurns Diarization = "turns"
+)
 
-// ModelExists checks if the whisper model exists at the given path.
-func ModelExists(modelPath string) bool {
-	_, err := os.Stat(modelPath)
-	return err == nil
+// Multilingual reports whether the options need a multilingual model rather
+// than an English-only one
+func (o TranscribeOptions) Multilingual() bool {
+	return o.Translate || (o.Language != "" && o.Language != "en")
 }
 
-// DownloadModel downloads the whisper model to the specified path.
-func DownloadModel(modelPath string, onProgress ProgressFunc) error {
-	return downloadModel(modelPath, onProgress)
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// ParseLanguage validates a language code for whisper, such as "en", "es"
+// or "auto"
+func ParseLanguage(s string) (string, error) {
+	lang := strings.ToLower(strings.TrimSpace(s))
+	if lang != LanguageAuto && !languagePattern.MatchString(lang) {
+		return "", fmt.Errorf("invalid language %q: expected a code such as en, es or de, or auto", s)
+	}
+	return lang, nil
 }
 
+// ProgressFunc is called with progress updates (0.0 to 1.0)
+type ProgressFunc func(percent float64)
+
 // ExtractAudioTrack extracts audio from a video file with progress reporting.
 func ExtractAudioTrack(inputPath string, duration time.Duration, onProgress ProgressFunc) (string, error) {
-	return extractAudio(inputPath, duration, onProgress)
+	return extractAudio(inputPath, 0, 0, duration, 1, onProgress)
+}
+
+// ExtractAudioClip extracts the audio between start and end, where end 0
+// means the end of the input. duration is the clip's length, for progress.
+// Timestamps in the extracted audio start at 0, not at start.
+func ExtractAudioClip(inputPath string, start, end, duration time.Duration, onProgress ProgressFunc) (string, error) {
+	return extractAudio(inputPath, start, end, duration, 1, onProgress)
+}
+
+// ExtractStereoClip is ExtractAudioClip keeping two channels, for
+// DiarizeStereo
+func ExtractStereoClip(inputPath string, start, end, duration time.Duration, onProgress ProgressFunc) (string, error) {
+	return extractAudio(inputPath, start, end, duration, 2, onProgress)
 }
 
 // TranscribeAudio transcribes an audio file using whisper.
 func TranscribeAudio(audioPath, modelPath string, onProgress ProgressFunc) ([]Segment, error) {
-	return runWhisper(audioPath, modelPath, onProgress)
+	transcript, err := runWhisper(audioPath, modelPath, TranscribeOptions{}, onProgress)
+	return transcript.Segments, err
+}
+
+// TranscribeAudioWithOptions transcribes an audio file using whisper in the
+// given language, or translated to English.
+func TranscribeAudioWithOptions(audioPath, modelPath string, opts TranscribeOptions, onProgress ProgressFunc) (Transcript, error) {
+	return runWhisper(audioPath, modelPath, opts, onProgress)
 }
 
 // Transcribe extracts audio from video and transcribes it using whisper-cli.
@@ -69,7 +162,7 @@ func Transcribe(inputPath, modelPath string, duration time.Duration, onProgress
 		}
 	}
 
-	audioPath, err := extractAudio(inputPath, duration, extractProgress)
+	audioPath, err := extractAudio(inputPath, 0, 0, duration, 1, extractProgress)
 	if err != nil {
 		return nil, fmt.Errorf("audio extraction failed: %w", err)
 	}
@@ -83,91 +176,17 @@ func Transcribe(inputPath, modelPath string, duration time.Duration, onProgress
 		}
 	}
 
-	segments, err := runWhisper(audioPath, modelPath, whisperProgress)
+	transcript, err := runWhisper(audioPath, modelPath, TranscribeOptions{}, whisperProgress)
 	if err != nil {
 		return nil, fmt.Errorf("whisper transcription failed: %w", err)
 	}
 
-	return segments, nil
-}
-
-// downloadModel downloads the whisper model to the specified path
-func downloadModel(modelPath string, onProgress ProgressFunc) error {
-	// Create the directory if it doesn't exist
-	modelDir := filepath.Dir(modelPath)
-	if err := os.MkdirAll(modelDir, 0o750); err != nil {
-		return fmt.Errorf("failed to create model directory: %w", err)
-	}
-
-	// Download the model
-	resp, err := http.Get(DefaultModelURL)
-	if err != nil {
-		return fmt.Errorf("failed to download model: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download model: HTTP %d", resp.StatusCode)
-	}
-
-	// Get content length for progress
-	contentLength := resp.ContentLength
-	if contentLength <= 0 {
-		contentLength = ModelSize // Use approximate size as fallback
-	}
-
-	// Create temp file for download
-	tempFile, err := os.CreateTemp(modelDir, "whisper-model-*.tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	tempPath := tempFile.Name()
-	defer func() {
-		_ = tempFile.Close()
-		_ = os.Remove(tempPath)
-	}()
-
-	// Copy with progress tracking
-	var written int64
-	buf := make([]byte, 32*1024)
-	for {
-		n, readErr := resp.Body.Read(buf)
-		if n > 0 {
-			_, writeErr := tempFile.Write(buf[:n])
-			if writeErr != nil {
-				return fmt.Errorf("failed to write model: %w", writeErr)
-			}
-			written += int64(n)
-			if onProgress != nil {
-				pct := float64(written) / float64(contentLength)
-				if pct > 1.0 {
-					pct = 1.0
-				}
-				onProgress(pct)
-			}
-		}
-		if readErr == io.EOF {
-			break
-		}
-		if readErr != nil {
-			return fmt.Errorf("failed to read model: %w", readErr)
-		}
-	}
-
-	if err := tempFile.Close(); err != nil {
-		return fmt.Errorf("failed to close temp file: %w", err)
-	}
-
-	// Move temp file to final location
-	if err := os.Rename(tempPath, modelPath); err != nil {
-		return fmt.Errorf("failed to move model to final location: %w", err)
-	}
-
-	return nil
+	return transcript.Segments, nil
 }
 
 // extractAudio extracts audio from video to a WAV file suitable for Whisper
-func extractAudio(inputPath string, duration time.Duration, onProgress ProgressFunc) (string, error) {
+// with the given number of channels, limited to start-end when either is set
+func extractAudio(inputPath string, start, end, duration time.Duration, channels int, onProgress ProgressFunc) (string, error) {
 	// Create temp file for audio
 	tempFile, err := os.CreateTemp("", "memorex-audio-*.wav")
 	if err != nil {
@@ -178,14 +197,23 @@ func extractAudio(inputPath string, duration time.Duration, onProgress ProgressF
 		return "", fmt.Errorf("failed to close temp file: %w", err)
 	}
 
+	// Seek on the input so only the clip is decoded
+	var args []string
+	if start > 0 {
+		args = append(args, "-ss", formatSeconds(start))
+	}
+	if end > 0 {
+		args = append(args, "-t", formatSeconds(end-start))
+	}
+
 	// Extract audio using FFmpeg
 	// - 16kHz sample rate (required by Whisper)
-	// - Mono channel
+	// - Mono, or stereo for diarization
 	// - 16-bit PCM WAV format
-	cmd := exec.Command("ffmpeg",
+	args = append(args,
 		"-i", inputPath,
 		"-ar", "16000",
-		"-ac", "1",
+		"-ac", strconv.Itoa(channels),
 		"-c:a", "pcm_s16le",
 		"-y",
 		"-loglevel", "error",
@@ -193,6 +221,7 @@ func extractAudio(inputPath string, duration time.Duration, onProgress ProgressF
 		"-nostats",
 		audioPath,
 	)
+	cmd := exec.Command("ffmpeg", args...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -218,6 +247,10 @@ func extractAudio(inputPath string, duration time.Duration, onProgress ProgressF
 	return audioPath, nil
 }
 
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
 // parseFFmpegProgress reads ffmpeg progress output and calls the callback
 func parseFFmpegProgress(stdout io.Reader, totalDuration time.Duration, onProgress ProgressFunc) {
 	scanner := bufio.NewScanner(stdout)
@@ -239,19 +272,36 @@ func parseFFmpegProgress(stdout io.Reader, totalDuration time.Duration, onProgre
 	}
 }
 
-// runWhisper runs the whisper-cli command and parses the output
-func runWhisper(audioPath, modelPath string, onProgress ProgressFunc) ([]Segment, error) {
-	// Create temp file for output
-	outputFile, err := os.CreateTemp("", "memorex-transcript-*.txt")
+// errNoJSONOutput is returned by whisperPass when whisper-cli is too old to
+// write JSON
+var errNoJSONOutput = errors.New("whisper-cli does not support JSON output")
+
+// runWhisper runs whisper-cli and parses its output: the full JSON output,
+// with token probabilities, or the timestamped lines it prints for builds
+// that can't write JSON
+func runWhisper(audioPath, modelPath string, opts TranscribeOptions, onProgress ProgressFunc) (Transcript, error) {
+	whisperCmd, err := findWhisper()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %w", err)
+		return Transcript{}, err
 	}
-	outputPath := outputFile.Name()
-	if err := outputFile.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close temp file: %w", err)
+
+	transcript, err := whisperPass(whisperCmd, audioPath, modelPath, opts, true, onProgress)
+	if errors.Is(err, errNoJSONOutput) {
+		transcript, err = whisperPass(whisperCmd, audioPath, modelPath, opts, false, onProgress)
+	}
+	if err != nil {
+		return Transcript{}, err
 	}
-	defer func() { _ = os.Remove(outputPath) }()
 
+	// Only a detected language is taken from whisper
+	if opts.Language != LanguageAuto {
+		transcript.Language = opts.Language
+	}
+	return transcript, nil
+}
+
+// findWhisper returns the whisper-cli command to run
+func findWhisper() (string, error) {
 	// Try whisper-cli first, then fall back to whisper
 	whisperCmd := "whisper-cli"
 	if _, err := exec.LookPath(whisperCmd); err != nil {
@@ -260,32 +310,70 @@ func runWhisper(audioPath, modelPath string, onProgress ProgressFunc) ([]Segment
 			// Try the path where make install-whisper puts it
 			whisperCmd = os.ExpandEnv("$HOME/.local/share/whisper.cpp/src/build/bin/whisper-cli")
 			if _, err := os.Stat(whisperCmd); err != nil {
-				return nil, fmt.Errorf("whisper-cli not found. Install whisper.cpp and ensure whisper-cli is in PATH")
+				return "", fmt.Errorf("whisper-cli not found. Install whisper.cpp and ensure whisper-cli is in PATH")
 			}
 		}
 	}
+	return whisperCmd, nil
+}
+
+// whisperPass runs whisper-cli once. With withJSON it also asks for the full
+// JSON output and parses that, falling back to the printed output if the
+// JSON can't be read.
+func whisperPass(whisperCmd, audioPath, modelPath string, opts TranscribeOptions, withJSON bool, onProgress ProgressFunc) (Transcript, error) {
+	// Create temp file for output
+	outputFile, err := os.CreateTemp("", "memorex-transcript-*.txt")
+	if err != nil {
+		return Transcript{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	outputPath := outputFile.Name()
+	if err := outputFile.Close(); err != nil {
+		return Transcript{}, fmt.Errorf("failed to close temp file: %w", err)
+	}
+	outputBase := strings.TrimSuffix(outputPath, ".txt")
+	jsonPath := outputBase + ".json"
+	defer func() {
+		_ = os.Remove(outputPath)
+		_ = os.Remove(jsonPath)
+	}()
 
 	// Run whisper with timestamps
-	cmd := exec.Command(whisperCmd,
+	args := []string{
 		"-m", modelPath,
 		"-f", audioPath,
 		"-otxt",
-		"-of", strings.TrimSuffix(outputPath, ".txt"),
+		"-of", outputBase,
 		"--print-progress", // Enable progress output
-	)
+	}
+	if withJSON {
+		args = append(args, "-oj", "-ojf")
+	}
+	if opts.Language != "" {
+		args = append(args, "-l", opts.Language)
+	}
+	if opts.Translate {
+		args = append(args, "-tr")
+	}
+	switch opts.Diarize {
+	case DiarizeStereo:
+		args = append(args, "-di")
+	case DiarizeTurns:
+		args = append(args, "-tdrz")
+	}
+	cmd := exec.Command(whisperCmd, args...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return Transcript{}, fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+		return Transcript{}, fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start whisper: %w", err)
+		return Transcript{}, fmt.Errorf("failed to start whisper: %w", err)
 	}
 
 	// Parse progress and collect output
@@ -302,21 +390,37 @@ func runWhisper(audioPath, modelPath string, onProgress ProgressFunc) ([]Segment
 		close(done)
 	}()
 
-	// Parse whisper progress from stderr (format: "whisper_print_progress_callback: progress = XX%")
-	if onProgress != nil {
-		go parseWhisperProgress(stderr, onProgress)
-	}
+	// Parse progress and the detected language from stderr
+	logs := make(chan whisperLog, 1)
+	go func() {
+		logs <- parseWhisperLog(stderr, onProgress)
+	}()
 
 	<-done
+	log := <-logs
 
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("whisper failed: %w", err)
+	waitErr := cmd.Wait()
+	// Some builds exit successfully after rejecting an argument
+	if withJSON && strings.HasPrefix(log.UnknownArgument, "-oj") {
+		return Transcript{}, errNoJSONOutput
+	}
+	if waitErr != nil {
+		return Transcript{}, fmt.Errorf("whisper failed: %w", waitErr)
 	}
 
-	output := outputBuilder.String()
+	if withJSON {
+		if data, err := os.ReadFile(jsonPath); err == nil {
+			if transcript, err := parseWhisperJSON(data, opts.Diarize); err == nil {
+				if transcript.Language == "" {
+					transcript.Language = log.Language
+				}
+				return transcript, nil
+			}
+		}
+	}
 
-	// Parse the whisper output from stderr/stdout which contains timestamps
-	segments := parseWhisperOutput(output)
+	// Parse the timestamps whisper prints to stdout
+	segments := parseWhisperOutput(outputBuilder.String())
 	if len(segments) == 0 {
 		// Fall back to reading the output file without timestamps
 		content, err := os.ReadFile(outputPath)
@@ -329,18 +433,44 @@ func runWhisper(audioPath, modelPath string, onProgress ProgressFunc) ([]Segment
 		}
 	}
 
-	return segments, nil
+	if opts.Diarize != DiarizeNone {
+		labelPrintedSpeakers(segments, opts.Diarize)
+	}
+	return Transcript{Segments: segments, Language: log.Language}, nil
 }
 
-// parseWhisperProgress parses whisper-cli progress output
-func parseWhisperProgress(stderr io.Reader, onProgress ProgressFunc) {
+// whisperLog is what parseWhisperLog finds in whisper-cli's log
+type whisperLog struct {
+	// Language is the language whisper detected, if it was asked to
+	Language string
+	// UnknownArgument is an argument whisper-cli rejected
+	UnknownArgument string
+}
+
+// parseWhisperLog reads whisper-cli's log, reporting progress (lines like
+// "whisper_print_progress_callback: progress = XX%") and returning the
+// language it detected and any argument it didn't recognize
+func parseWhisperLog(stderr io.Reader, onProgress ProgressFunc) whisperLog {
 	scanner := bufio.NewScanner(stderr)
 	progressPattern := regexp.MustCompile(`progress\s*=\s*(\d+)%`)
+	detectedPattern := regexp.MustCompile(`auto-detected language:\s*([a-z]+)`)
+	unknownPattern := regexp.MustCompile(`unknown argument:\s*(\S+)`)
 
+	var log whisperLog
 	for scanner.Scan() {
 		line := scanner.Text()
+		if matches := detectedPattern.FindStringSubmatch(line); matches != nil {
+			log.Language = matches[1]
+			continue
+		}
+		if matches := unknownPattern.FindStringSubmatch(line); matches != nil {
+			if log.UnknownArgument == "" {
+				log.UnknownArgument = matches[1]
+			}
+			continue
+		}
 		matches := progressPattern.FindStringSubmatch(line)
-		if matches != nil {
+		if matches != nil && onProgress != nil {
 			pct, err := strconv.Atoi(matches[1])
 			if err != nil {
 				continue
@@ -348,6 +478,7 @@ func parseWhisperProgress(stderr io.Reader, onProgress ProgressFunc) {
 			onProgress(float64(pct) / 100.0)
 		}
 	}
+	return log
 }
 
 // parseWhisperOutput parses whisper-cli output with timestamps
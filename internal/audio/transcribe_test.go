@@ -3,6 +3,8 @@ package audio
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -17,7 +19,7 @@ func TestExtractAudio(t *testing.T) {
 	testVideo := createTestVideoWithAudio(t)
 	defer func() { _ = os.Remove(testVideo) }()
 
-	audioPath, err := extractAudio(testVideo, time.Second, nil)
+	audioPath, err := extractAudio(testVideo, 0, 0, time.Second, 1, nil)
 	if err != nil {
 		t.Fatalf("extractAudio failed: %v", err)
 	}
@@ -34,7 +36,7 @@ func TestExtractAudio(t *testing.T) {
 }
 
 func TestExtractAudioNonexistent(t *testing.T) {
-	_, err := extractAudio("/nonexistent/video.mp4", 0, nil)
+	_, err := extractAudio("/nonexistent/video.mp4", 0, 0, 0, 1, nil)
 	if err == nil {
 		t.Error("Expected error for nonexistent file")
 	}
@@ -125,6 +127,197 @@ No timestamps here`
 	}
 }
 
+func TestSegmentShift(t *testing.T) {
+	seg := Segment{
+		Start: time.Second,
+		End:   3 * time.Second,
+		Text:  "hello there",
+		Words: []Word{
+			{Text: "hello", Start: time.Second, End: 2 * time.Second},
+			{Text: "there", Start: 2 * time.Second, End: 3 * time.Second},
+		},
+	}
+
+	// A clip starting 90s into the input
+	shifted := seg.Shift(90 * time.Second)
+	if shifted.Start != 91*time.Second || shifted.End != 93*time.Second {
+		t.Errorf("Expected the segment at 91s-93s, got %v-%v", shifted.Start, shifted.End)
+	}
+	for i, want := range []time.Duration{91 * time.Second, 92 * time.Second} {
+		if w := shifted.Words[i]; w.Start != want || w.End != want+time.Second {
+			t.Errorf("Expected word %d at %v, got %v-%v", i, want, w.Start, w.End)
+		}
+	}
+	if seg.Words[0].Start != time.Second {
+		t.Errorf("Expected the original words to be left alone, got %v", seg.Words[0].Start)
+	}
+
+	if plain := (Segment{Start: time.Second}).Shift(time.Minute); plain.Words != nil {
+		t.Errorf("Expected no words to stay nil, got %v", plain.Words)
+	}
+}
+
+func TestParseWhisperLog(t *testing.T) {
+	log := `whisper_init_from_file_with_params_no_state: loading model from 'ggml-base.bin'
+whisper_full_with_state: auto-detected language: es (p = 0.974213)
+whisper_print_progress_callback: progress =  50%
+whisper_print_progress_callback: progress = 100%`
+
+	var progress []float64
+	parsed := parseWhisperLog(strings.NewReader(log), func(p float64) { progress = append(progress, p) })
+	if parsed.Language != "es" {
+		t.Errorf("Expected detected language es, got %q", parsed.Language)
+	}
+	if parsed.UnknownArgument != "" {
+		t.Errorf("Expected no unknown argument, got %q", parsed.UnknownArgument)
+	}
+	if len(progress) != 2 || progress[0] != 0.5 || progress[1] != 1 {
+		t.Errorf("Expected progress [0.5 1], got %v", progress)
+	}
+
+	// Progress is optional, and nothing is detected unless asked
+	if parsed := parseWhisperLog(strings.NewReader("progress = 10%"), nil); parsed.Language != "" {
+		t.Errorf("Expected no detected language, got %q", parsed.Language)
+	}
+}
+
+func TestParseWhisperLogUnknownArgument(t *testing.T) {
+	log := `error: unknown argument: -ojf
+
+usage: whisper-cli [options] file0.wav file1.wav ...`
+
+	if parsed := parseWhisperLog(strings.NewReader(log), nil); parsed.UnknownArgument != "-ojf" {
+		t.Errorf("Expected unknown argument -ojf, got %q", parsed.UnknownArgument)
+	}
+}
+
+func TestRunWhisperJSON(t *testing.T) {
+	fakeWhisper(t, `
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-of) out="$2"; shift ;;
+	esac
+	shift
+done
+echo "[00:00:00.000 --> 00:00:02.000]  Printed text."
+cat > "$out.json" <<'JSON'
+{"result": {"language": "de"}, "transcription": [
+	{"offsets": {"from": 0, "to": 2000}, "text": " Hallo.", "tokens": [{"text": " Hallo.", "p": 0.5}]}
+]}
+JSON
+`)
+
+	transcript, err := runWhisper("audio.wav", "model.bin", TranscribeOptions{Language: LanguageAuto}, nil)
+	if err != nil {
+		t.Fatalf("runWhisper failed: %v", err)
+	}
+	if transcript.Language != "de" || len(transcript.Segments) != 1 {
+		t.Fatalf("Expected one German segment, got %+v", transcript)
+	}
+	if seg := transcript.Segments[0]; seg.Text != "Hallo." || seg.Confidence != 0.5 {
+		t.Errorf("Expected the JSON segment, got %+v", seg)
+	}
+}
+
+func TestRunWhisperWithoutJSON(t *testing.T) {
+	fakeWhisper(t, `
+for arg in "$@"; do
+	if [ "$arg" = "-ojf" ]; then
+		echo "error: unknown argument: -ojf" >&2
+		exit 0
+	fi
+done
+echo "[00:00:00.000 --> 00:00:02.000]  Hello there."
+echo "[00:00:02.000 --> 00:00:04.000]  General Kenobi."
+`)
+
+	transcript, err := runWhisper("audio.wav", "model.bin", TranscribeOptions{Language: "en"}, nil)
+	if err != nil {
+		t.Fatalf("runWhisper failed: %v", err)
+	}
+	if len(transcript.Segments) != 2 || transcript.Segments[1].Start != 2*time.Second {
+		t.Fatalf("Expected two timed segments from the printed output, got %+v", transcript.Segments)
+	}
+	if transcript.Language != "en" || transcript.Segments[0].Confidence != 0 {
+		t.Errorf("Expected English with unknown confidence, got %+v", transcript)
+	}
+}
+
+func TestRunWhisperDiarize(t *testing.T) {
+	fakeWhisper(t, `
+speaker=""
+for arg in "$@"; do
+	if [ "$arg" = "-di" ]; then
+		speaker="(speaker 1)"
+	fi
+done
+echo "[00:00:00.000 --> 00:00:02.000]  ${speaker}Hello."
+`)
+
+	transcript, err := runWhisper("audio.wav", "model.bin", TranscribeOptions{Diarize: DiarizeStereo}, nil)
+	if err != nil {
+		t.Fatalf("runWhisper failed: %v", err)
+	}
+	if seg := transcript.Segments[0]; seg.Speaker != 2 || seg.Text != "Hello." {
+		t.Errorf("Expected Speaker 2 saying Hello., got %+v", seg)
+	}
+}
+
+// fakeWhisper puts a whisper-cli shell script with the given body first in
+// PATH
+func fakeWhisper(t *testing.T, body string) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found, skipping test")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" + body
+	if err := os.WriteFile(filepath.Join(dir, "whisper-cli"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"en", "en", false},
+		{" DE ", "de", false},
+		{"auto", "auto", false},
+		{"yue", "yue", false},
+		{"spanish", "", true},
+		{"e1", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLanguage(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLanguage(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTranscribeOptionsMultilingual(t *testing.T) {
+	tests := []struct {
+		opts TranscribeOptions
+		want bool
+	}{
+		{TranscribeOptions{}, false},
+		{TranscribeOptions{Language: "en"}, false},
+		{TranscribeOptions{Language: "de"}, true},
+		{TranscribeOptions{Language: LanguageAuto}, true},
+		{TranscribeOptions{Language: "en", Translate: true}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Multilingual(); got != tt.want {
+			t.Errorf("%+v.Multilingual() = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
+
 func TestTranscribeModelNotFound(t *testing.T) {
 	_, err := Transcribe("/some/video.mp4", "/nonexistent/model.bin", 0, nil)
 	if err == nil {
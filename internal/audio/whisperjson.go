@@ -0,0 +1,137 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// whisperJSON is the subset of whisper-cli's full JSON output (-oj -ojf)
+// that memorex reads
+type whisperJSON struct {
+	Result struct {
+		Language string `json:"language"`
+	} `json:"result"`
+	Transcription []struct {
+		Offsets whisperOffsets `json:"offsets"`
+		Text    string         `json:"text"`
+		Tokens  []struct {
+			Text        string         `json:"text"`
+			Offsets     whisperOffsets `json:"offsets"`
+			Probability float64        `json:"p"`
+		} `json:"tokens"`
+		// Speaker is set with -di: "0", "1" or "?"
+		Speaker string `json:"speaker"`
+		// SpeakerTurnNext is set with -tdrz when the next segment is
+		// another speaker
+		SpeakerTurnNext bool `json:"speaker_turn_next"`
+	} `json:"transcription"`
+}
+
+// whisperOffsets are times in milliseconds from the start of the audio
+type whisperOffsets struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// parseWhisperJSON parses whisper-cli's full JSON output into a transcript,
+// grouping each segment's tokens into words. The full output turns on token
+// timestamps, so words are timed without splitting segments with -ml.
+// Language is whatever whisper reports, which is the detected language when
+// it was asked to detect one. Speakers are labeled for diarize.
+func parseWhisperJSON(data []byte, diarize Diarization) (Transcript, error) {
+	var doc whisperJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Transcript{}, fmt.Errorf("failed to parse whisper JSON: %w", err)
+	}
+
+	transcript := Transcript{Language: doc.Result.Language}
+	var turns []bool
+	for _, s := range doc.Transcription {
+		text, turn := cutSpeakerTurn(s.Text)
+		turn = turn || s.SpeakerTurnNext
+		if text == "" {
+			// A turn after a silent segment still follows the last one
+			if n := len(turns); turn && n > 0 {
+				turns[n-1] = true
+			}
+			continue
+		}
+
+		seg := Segment{
+			Start: time.Duration(s.Offsets.From) * time.Millisecond,
+			End:   time.Duration(s.Offsets.To) * time.Millisecond,
+			Text:  text,
+		}
+		if diarize == DiarizeStereo {
+			seg.Speaker = stereoSpeaker(s.Speaker)
+		}
+
+		var sum float64
+		var count int
+		for _, tok := range s.Tokens {
+			if isSpecialToken(tok.Text) {
+				continue
+			}
+			sum += tok.Probability
+			count++
+
+			start := time.Duration(tok.Offsets.From) * time.Millisecond
+			end := time.Duration(tok.Offsets.To) * time.Millisecond
+			// Tokens that don't start with a space continue the word
+			if n := len(seg.Words); n > 0 && !strings.HasPrefix(tok.Text, " ") {
+				w := &seg.Words[n-1]
+				w.Text += tok.Text
+				w.End = end
+				w.Probability = min(w.Probability, tok.Probability)
+				continue
+			}
+			seg.Words = append(seg.Words, Word{
+				Text:        strings.TrimPrefix(tok.Text, " "),
+				Start:       start,
+				End:         end,
+				Probability: tok.Probability,
+			})
+		}
+		if count > 0 {
+			seg.Confidence = sum / float64(count)
+		}
+		if !wordsMatch(seg) {
+			seg.Words = nil
+		}
+		transcript.Segments = append(transcript.Segments, seg)
+		turns = append(turns, turn)
+	}
+	if diarize == DiarizeTurns {
+		assignTurns(transcript.Segments, turns)
+	}
+	return transcript, nil
+}
+
+// isSpecialToken reports whether a token is one of whisper's control tokens,
+// such as [_BEG_] or [_TT_150], rather than text
+func isSpecialToken(text string) bool {
+	return (strings.HasPrefix(text, "[_") && strings.HasSuffix(text, "]")) ||
+		(strings.HasPrefix(text, "<|") && strings.HasSuffix(text, "|>"))
+}
+
+// wordsMatch reports whether a segment's words can stand in for its text.
+// whisper.cpp splits some characters across tokens and writes the halves as
+// invalid UTF-8, which decodes as replacement characters, and token times
+// are only set when it computes token timestamps.
+func wordsMatch(seg Segment) bool {
+	if len(seg.Words) == 0 || seg.Words[len(seg.Words)-1].End == 0 {
+		return false
+	}
+	texts := make([]string, len(seg.Words))
+	for i, w := range seg.Words {
+		if w.End < w.Start {
+			return false
+		}
+		texts[i] = w.Text
+	}
+	joined := strings.Join(texts, " ")
+	return joined == seg.Text && !strings.ContainsRune(joined, utf8.RuneError)
+}
@@ -0,0 +1,195 @@
+package audio
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// whisperFullJSON is trimmed from whisper-cli -oj -ojf output
+const whisperFullJSON = `{
+	"systeminfo": "AVX = 1 | NEON = 0",
+	"model": {"type": "base", "multilingual": true, "vocab": 51865},
+	"params": {"model": "ggml-base.bin", "language": "auto", "translate": false},
+	"result": {"language": "es"},
+	"transcription": [
+		{
+			"timestamps": {"from": "00:00:00,000", "to": "00:00:02,500"},
+			"offsets": {"from": 0, "to": 2500},
+			"text": " Hola a todos.",
+			"tokens": [
+				{"text": "[_BEG_]", "timestamps": {"from": "00:00:00,000", "to": "00:00:00,000"}, "offsets": {"from": 0, "to": 0}, "id": 50365, "p": 0.99, "t_dtw": -1},
+				{"text": " Hola", "timestamps": {"from": "00:00:00,000", "to": "00:00:00,800"}, "offsets": {"from": 0, "to": 800}, "id": 22637, "p": 0.9, "t_dtw": -1},
+				{"text": " a", "timestamps": {"from": "00:00:00,800", "to": "00:00:01,200"}, "offsets": {"from": 800, "to": 1200}, "id": 257, "p": 0.8, "t_dtw": -1},
+				{"text": " todos.", "timestamps": {"from": "00:00:01,200", "to": "00:00:02,500"}, "offsets": {"from": 1200, "to": 2500}, "id": 14869, "p": 0.7, "t_dtw": -1},
+				{"text": "[_TT_125]", "timestamps": {"from": "00:00:02,500", "to": "00:00:02,500"}, "offsets": {"from": 2500, "to": 2500}, "id": 50490, "p": 0.5, "t_dtw": -1}
+			]
+		},
+		{
+			"timestamps": {"from": "00:00:02,500", "to": "00:00:03,000"},
+			"offsets": {"from": 2500, "to": 3000},
+			"text": " ",
+			"tokens": []
+		},
+		{
+			"timestamps": {"from": "00:01:05,000", "to": "00:01:09,120"},
+			"offsets": {"from": 65000, "to": 69120},
+			"text": " Gracias.",
+			"tokens": []
+		}
+	]
+}`
+
+func TestParseWhisperJSON(t *testing.T) {
+	transcript, err := parseWhisperJSON([]byte(whisperFullJSON), DiarizeNone)
+	if err != nil {
+		t.Fatalf("parseWhisperJSON failed: %v", err)
+	}
+
+	if transcript.Language != "es" {
+		t.Errorf("Expected language es, got %q", transcript.Language)
+	}
+	if len(transcript.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d: %+v", len(transcript.Segments), transcript.Segments)
+	}
+
+	first := transcript.Segments[0]
+	if first.Text != "Hola a todos." || first.Start != 0 || first.End != 2500*time.Millisecond {
+		t.Errorf("Unexpected first segment %+v", first)
+	}
+	// Special tokens don't count towards confidence
+	if math.Abs(first.Confidence-0.8) > 1e-9 {
+		t.Errorf("Expected confidence 0.8, got %v", first.Confidence)
+	}
+
+	want := []Word{
+		{Text: "Hola", Start: 0, End: 800 * time.Millisecond, Probability: 0.9},
+		{Text: "a", Start: 800 * time.Millisecond, End: 1200 * time.Millisecond, Probability: 0.8},
+		{Text: "todos.", Start: 1200 * time.Millisecond, End: 2500 * time.Millisecond, Probability: 0.7},
+	}
+	if !reflect.DeepEqual(first.Words, want) {
+		t.Errorf("Expected words %+v, got %+v", want, first.Words)
+	}
+
+	last := transcript.Segments[1]
+	if last.Start != 65*time.Second || last.End != 69120*time.Millisecond {
+		t.Errorf("Expected 1:05-1:09.12, got %v-%v", last.Start, last.End)
+	}
+	if last.Confidence != 0 {
+		t.Errorf("Expected unknown confidence without tokens, got %v", last.Confidence)
+	}
+	if last.Words != nil {
+		t.Errorf("Expected no words without tokens, got %+v", last.Words)
+	}
+}
+
+func TestParseWhisperJSONWords(t *testing.T) {
+	data := `{"transcription": [
+		{"offsets": {"from": 0, "to": 3000}, "text": " Deploy to Kubernetes, then.", "tokens": [
+			{"text": " Deploy", "offsets": {"from": 0, "to": 600}, "p": 0.97},
+			{"text": " to", "offsets": {"from": 600, "to": 800}, "p": 0.99},
+			{"text": " Kub", "offsets": {"from": 800, "to": 1100}, "p": 0.6},
+			{"text": "ern", "offsets": {"from": 1100, "to": 1400}, "p": 0.3},
+			{"text": "etes", "offsets": {"from": 1400, "to": 1900}, "p": 0.95},
+			{"text": ",", "offsets": {"from": 1900, "to": 2000}, "p": 0.9},
+			{"text": " then.", "offsets": {"from": 2000, "to": 3000}, "p": 0.8}
+		]},
+		{"offsets": {"from": 3000, "to": 4000}, "text": " 日本", "tokens": [
+			{"text": " \ufffd", "offsets": {"from": 3000, "to": 3400}, "p": 0.9},
+			{"text": "\ufffd本", "offsets": {"from": 3400, "to": 4000}, "p": 0.9}
+		]},
+		{"offsets": {"from": 4000, "to": 5000}, "text": " Untimed", "tokens": [
+			{"text": " Untimed", "offsets": {"from": 0, "to": 0}, "p": 0.9}
+		]}
+	]}`
+
+	transcript, err := parseWhisperJSON([]byte(data), DiarizeNone)
+	if err != nil {
+		t.Fatalf("parseWhisperJSON failed: %v", err)
+	}
+
+	words := transcript.Segments[0].Words
+	if len(words) != 4 {
+		t.Fatalf("Expected 4 words, got %+v", words)
+	}
+	// Tokens without a leading space join the word before them
+	kubernetes := words[2]
+	if kubernetes.Text != "Kubernetes," || kubernetes.Start != 800*time.Millisecond || kubernetes.End != 2*time.Second {
+		t.Errorf("Expected Kubernetes, from 0.8s to 2s, got %+v", kubernetes)
+	}
+	if kubernetes.Probability != 0.3 {
+		t.Errorf("Expected the word's lowest token probability 0.3, got %v", kubernetes.Probability)
+	}
+
+	// Words that don't reproduce the text are dropped
+	for _, seg := range transcript.Segments[1:] {
+		if seg.Words != nil {
+			t.Errorf("Expected no words for %q, got %+v", seg.Text, seg.Words)
+		}
+	}
+}
+
+func TestParseWhisperJSONSpeakers(t *testing.T) {
+	stereo := `{"transcription": [
+		{"offsets": {"from": 0, "to": 1000}, "text": " Hello?", "speaker": "0"},
+		{"offsets": {"from": 1000, "to": 2000}, "text": " Hi.", "speaker": "1"},
+		{"offsets": {"from": 2000, "to": 3000}, "text": " Both.", "speaker": "?"}
+	]}`
+	transcript, err := parseWhisperJSON([]byte(stereo), DiarizeStereo)
+	if err != nil {
+		t.Fatalf("parseWhisperJSON failed: %v", err)
+	}
+	assertSpeakers(t, transcript.Segments, []int{1, 2, 0})
+
+	turns := `{"transcription": [
+		{"offsets": {"from": 0, "to": 1000}, "text": " Question?", "speaker_turn_next": true},
+		{"offsets": {"from": 1000, "to": 2000}, "text": " Answer,"},
+		{"offsets": {"from": 2000, "to": 2500}, "text": " ", "speaker_turn_next": true},
+		{"offsets": {"from": 2500, "to": 3000}, "text": " Follow-up."}
+	]}`
+	transcript, err = parseWhisperJSON([]byte(turns), DiarizeTurns)
+	if err != nil {
+		t.Fatalf("parseWhisperJSON failed: %v", err)
+	}
+	// The turn after the silent segment applies to the answer before it
+	assertSpeakers(t, transcript.Segments, []int{1, 2, 1})
+
+	// Speakers are left unset unless asked for
+	transcript, _ = parseWhisperJSON([]byte(stereo), DiarizeNone)
+	assertSpeakers(t, transcript.Segments, []int{0, 0, 0})
+}
+
+func assertSpeakers(t *testing.T, segments []Segment, want []int) {
+	t.Helper()
+	if len(segments) != len(want) {
+		t.Fatalf("Expected %d segments, got %+v", len(want), segments)
+	}
+	for i, w := range want {
+		if segments[i].Speaker != w {
+			t.Errorf("Segment %d %q is Speaker %d, want %d", i, segments[i].Text, segments[i].Speaker, w)
+		}
+	}
+}
+
+func TestParseWhisperJSONInvalid(t *testing.T) {
+	if _, err := parseWhisperJSON([]byte(`{"transcription": [`), DiarizeNone); err == nil {
+		t.Error("Expected error for truncated JSON")
+	}
+}
+
+func TestIsSpecialToken(t *testing.T) {
+	tests := map[string]bool{
+		"[_BEG_]":       true,
+		"[_TT_150]":     true,
+		"<|endoftext|>": true,
+		" Hello":        false,
+		"[":             false,
+		" [music]":      false,
+	}
+	for text, want := range tests {
+		if got := isSpecialToken(text); got != want {
+			t.Errorf("isSpecialToken(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
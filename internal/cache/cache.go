@@ -0,0 +1,188 @@
+// Package cache stores intermediate processing results so re-runs can skip
+// stages whose inputs haven't changed.
+//
+// Entries are content-addressed: each input file gets a directory named after
+// the SHA-256 of its contents, and each stage result inside it is keyed by the
+// stage name plus a hash of the parameters that produced it. Remote inputs,
+// which can't be hashed without downloading them, are identified by their URL
+// and the validators (ETag or Last-Modified) the server reports.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirEnv is the environment variable that overrides the cache location
+const DirEnv = "MEMOREX_CACHE_DIR"
+
+// urlClient asks servers about remote inputs. The answer only decides
+// whether results can be cached, so a slow server gives up the cache rather
+// than holding up processing.
+var urlClient = &http.Client{Timeout: 10 * time.Second}
+
+// Cache is a directory of cached results, one subdirectory per input file
+type Cache struct {
+	root string
+}
+
+// Input holds the cached results for a single input file
+type Input struct {
+	dir string
+	// Hash is the SHA-256 of the input file contents, or of the URL and
+	// validators of a remote input
+	Hash string
+}
+
+// DefaultDir returns the cache location: $MEMOREX_CACHE_DIR if set,
+// otherwise memorex/ under the user cache directory
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+	return filepath.Join(base, "memorex"), nil
+}
+
+// Open creates the cache directory if needed and returns a Cache for it
+func Open(root string) (*Cache, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{root: root}, nil
+}
+
+// ForInput hashes the input file and returns its cache entry
+func (c *Cache) ForInput(inputPath string) (*Input, error) {
+	hash, err := HashFile(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Input{dir: filepath.Join(c.root, hash), Hash: hash}, nil
+}
+
+// ForURL returns the cache entry for a remote input. The server is asked
+// for the URL's ETag or Last-Modified date, so the entry changes when the
+// content does; URLs without either, or whose server doesn't answer within
+// a few seconds, can't be cached.
+func (c *Cache) ForURL(url string) (*Input, error) {
+	resp, err := urlClient.Head(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check input URL: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to check input URL: HTTP %d", resp.StatusCode)
+	}
+
+	validators := []string{
+		resp.Header.Get("ETag"),
+		resp.Header.Get("Last-Modified"),
+	}
+	if validators[0] == "" && validators[1] == "" {
+		return nil, fmt.Errorf("server sent no ETag or Last-Modified for %s", url)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{url, resp.Header.Get("Content-Length")}, validators...), "\n")))
+	hash := hex.EncodeToString(sum[:])
+	return &Input{dir: filepath.Join(c.root, hash), Hash: hash}, nil
+}
+
+// HashFile returns the hex SHA-256 of a file's contents
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open input for hashing: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash input: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Key returns the cache key for a stage run with the given parameters.
+// Parameters are JSON-encoded, so any change to them produces a new key.
+func Key(stage string, params any) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cache parameters: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return stage + "-" + hex.EncodeToString(sum[:8]), nil
+}
+
+// Load reads a cached stage result into v. It reports false if there is no
+// entry for the key.
+func (in *Input) Load(key string, v any) (bool, error) {
+	data, err := os.ReadFile(in.metaPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode cache entry %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Store saves a stage result. It is written to a temp file and renamed into
+// place, so a stored entry is always complete.
+func (in *Input) Store(key string, v any) error {
+	if err := os.MkdirAll(in.dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(in.dir, key+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	defer func() { _ = os.Remove(tempPath) }()
+
+	if _, err := tempFile.Write(data); err != nil {
+		_ = tempFile.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, in.metaPath(key)); err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	return nil
+}
+
+// Dir returns a directory for files belonging to a stage, such as extracted
+// frames. Store the stage's manifest with the same key once the files are
+// complete; files the manifest doesn't list are treated as incomplete.
+func (in *Input) Dir(key string) string {
+	return filepath.Join(in.dir, key)
+}
+
+func (in *Input) metaPath(key string) string {
+	return filepath.Join(in.dir, key+".json")
+}
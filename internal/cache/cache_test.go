@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashFile(t *testing.T) {
+	tempDir := t.TempDir()
+	a := filepath.Join(tempDir, "a.bin")
+	b := filepath.Join(tempDir, "b.bin")
+	if err := os.WriteFile(a, []byte("same content"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(b, []byte("same content"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	hashA, err := HashFile(a)
+	if err != nil {
+		t.Fatalf("HashFile failed: %v", err)
+	}
+	hashB, err := HashFile(b)
+	if err != nil {
+		t.Fatalf("HashFile failed: %v", err)
+	}
+
+	if hashA != hashB {
+		t.Error("Expected identical contents to hash the same regardless of name")
+	}
+	if len(hashA) != 64 {
+		t.Errorf("Expected 64-character hex digest, got %d characters", len(hashA))
+	}
+
+	if _, err := HashFile(filepath.Join(tempDir, "missing.bin")); err == nil {
+		t.Error("Expected error for nonexistent file")
+	}
+}
+
+func TestKey(t *testing.T) {
+	type params struct {
+		FPS   float64
+		Model string
+	}
+
+	k1, err := Key("frames", params{FPS: 1})
+	if err != nil {
+		t.Fatalf("Key failed: %v", err)
+	}
+	k2, _ := Key("frames", params{FPS: 1})
+	k3, _ := Key("frames", params{FPS: 2})
+	k4, _ := Key("scores", params{FPS: 1})
+
+	if k1 != k2 {
+		t.Error("Expected equal parameters to produce equal keys")
+	}
+	if k1 == k3 {
+		t.Error("Expected different parameters to produce different keys")
+	}
+	if k1 == k4 {
+		t.Error("Expected different stages to produce different keys")
+	}
+}
+
+func TestStoreAndLoad(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	inputPath := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(inputPath, []byte("video data"), 0o600); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	in, err := c.ForInput(inputPath)
+	if err != nil {
+		t.Fatalf("ForInput failed: %v", err)
+	}
+
+	var scores []float64
+	found, err := in.Load("scores-abc", &scores)
+	if err != nil || found {
+		t.Fatalf("Expected cache miss, got found=%v err=%v", found, err)
+	}
+
+	if err := in.Store("scores-abc", []float64{0, 0.5, 0.9}); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	found, err = in.Load("scores-abc", &scores)
+	if err != nil || !found {
+		t.Fatalf("Expected cache hit, got found=%v err=%v", found, err)
+	}
+	if len(scores) != 3 || scores[1] != 0.5 {
+		t.Errorf("Unexpected cached scores: %v", scores)
+	}
+
+	// A second lookup of the same contents shares the entry
+	again, err := c.ForInput(inputPath)
+	if err != nil {
+		t.Fatalf("ForInput failed: %v", err)
+	}
+	if found, _ := again.Load("scores-abc", &scores); !found {
+		t.Error("Expected cache hit for the same input")
+	}
+}
+
+func TestDefaultDirEnv(t *testing.T) {
+	t.Setenv(DirEnv, "/custom/cache")
+	dir, err := DefaultDir()
+	if err != nil {
+		t.Fatalf("DefaultDir failed: %v", err)
+	}
+	if dir != "/custom/cache" {
+		t.Errorf("Expected /custom/cache, got %s", dir)
+	}
+}
+
+func TestForURL(t *testing.T) {
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/talk.mp4":
+			w.Header().Set("ETag", etag)
+		case "/missing.mp4":
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	first, err := c.ForURL(server.URL + "/talk.mp4")
+	if err != nil {
+		t.Fatalf("ForURL failed: %v", err)
+	}
+	again, _ := c.ForURL(server.URL + "/talk.mp4")
+	if first.Hash != again.Hash {
+		t.Error("Expected the same URL and ETag to share an entry")
+	}
+
+	// New content behind the same URL gets a new entry
+	etag = `"v2"`
+	changed, err := c.ForURL(server.URL + "/talk.mp4")
+	if err != nil {
+		t.Fatalf("ForURL failed: %v", err)
+	}
+	if changed.Hash == first.Hash {
+		t.Error("Expected a new ETag to change the entry")
+	}
+
+	// Without validators the content can't be identified
+	if _, err := c.ForURL(server.URL + "/stream.mp4"); err == nil {
+		t.Error("Expected error for a URL without ETag or Last-Modified")
+	}
+	if _, err := c.ForURL(server.URL + "/missing.mp4"); err == nil {
+		t.Error("Expected error for a missing URL")
+	}
+}
+
+func TestForURLTimeout(t *testing.T) {
+	oldClient := urlClient
+	urlClient = &http.Client{Timeout: 50 * time.Millisecond}
+	t.Cleanup(func() { urlClient = oldClient })
+
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := c.ForURL(server.URL + "/talk.mp4"); err == nil {
+		t.Error("Expected error for a server that doesn't answer")
+	}
+}
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"math"
+	"sort"
+)
+
+// MinBudgetScale is the smallest frame scale PlanBudget will pick before it
+// starts dropping keyframes. Below this, on-screen text becomes unreadable.
+const MinBudgetScale = 0.25
+
+// budgetScaleStep is how much PlanBudget lowers the scale on each attempt
+const budgetScaleStep = 0.05
+
+// BudgetPlan describes how to fit keyframes into a token budget
+type BudgetPlan struct {
+	Scale    float64 // Scale to save keyframes at
+	Keep     []int   // Positions of kept keyframes, in chronological order
+	Dropped  []int   // Positions of dropped keyframes, in chronological order
+	Estimate int     // Estimated total tokens for the plan
+}
+
+// PlanBudget picks a frame scale and the set of keyframes to keep so the
+// estimated output fits within maxTokens.
+//
+// textTokens is the estimate for everything except images (metadata and
+// transcript). dissimilarity holds one score per keyframe, higher meaning a
+// bigger visual change; width and height are the source frame dimensions.
+//
+// The scale is lowered in small steps from maxScale towards MinBudgetScale
+// until every keyframe fits. If even that is not enough, the least
+// dissimilar keyframes are dropped. The first keyframe is always ranked first
+// so the output keeps a reference image for the opening of the video.
+func PlanBudget(maxTokens, textTokens int, dissimilarity []float64, width, height int, maxScale float64) BudgetPlan {
+	all := make([]int, len(dissimilarity))
+	for i := range all {
+		all[i] = i
+	}
+
+	plan := BudgetPlan{Scale: maxScale}
+	for _, scale := range budgetScales(maxScale) {
+		plan.Scale = scale
+		cost := ImageTokens(int(float64(width)*scale), int(float64(height)*scale))
+		if textTokens+len(all)*cost <= maxTokens {
+			plan.Keep = all
+			plan.Estimate = textTokens + len(all)*cost
+			return plan
+		}
+	}
+
+	// Even the smallest scale doesn't fit; keep the most dissimilar frames
+	cost := ImageTokens(int(float64(width)*plan.Scale), int(float64(height)*plan.Scale))
+	n := 0
+	if maxTokens > textTokens {
+		n = min((maxTokens-textTokens)/cost, len(all))
+	}
+
+	ranked := append([]int(nil), all...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a == 0 || b == 0 {
+			return a == 0
+		}
+		return dissimilarity[a] > dissimilarity[b]
+	})
+
+	plan.Keep = append([]int(nil), ranked[:n]...)
+	plan.Dropped = append([]int(nil), ranked[n:]...)
+	sort.Ints(plan.Keep)
+	sort.Ints(plan.Dropped)
+	plan.Estimate = textTokens + n*cost
+
+	return plan
+}
+
+// budgetScales returns the scales PlanBudget tries, largest first
+func budgetScales(maxScale float64) []float64 {
+	scales := []float64{maxScale}
+	for s := maxScale - budgetScaleStep; s >= MinBudgetScale-1e-9; s -= budgetScaleStep {
+		scales = append(scales, math.Round(s*100)/100)
+	}
+	return scales
+}
@@ -0,0 +1,71 @@
+package output
+
+import (
+	"testing"
+)
+
+func TestPlanBudgetFitsAtFullScale(t *testing.T) {
+	// 1280x720 at 0.5 = 640x360 = 308 tokens per image
+	plan := PlanBudget(10000, 500, []float64{1, 0.5, 0.4}, 1280, 720, 0.5)
+
+	if plan.Scale != 0.5 {
+		t.Errorf("Expected scale to stay at 0.5, got %.2f", plan.Scale)
+	}
+	if len(plan.Keep) != 3 || len(plan.Dropped) != 0 {
+		t.Errorf("Expected all 3 keyframes kept, got keep=%v dropped=%v", plan.Keep, plan.Dropped)
+	}
+	if plan.Estimate > 10000 {
+		t.Errorf("Estimate %d exceeds budget", plan.Estimate)
+	}
+}
+
+func TestPlanBudgetReducesScale(t *testing.T) {
+	// At 0.5 each image is 308 tokens (1424 total); at 0.4 it is 197 (1091 total)
+	plan := PlanBudget(1100, 500, []float64{1, 0.5, 0.4}, 1280, 720, 0.5)
+
+	if plan.Scale >= 0.5 || plan.Scale < MinBudgetScale {
+		t.Errorf("Expected scale reduced below 0.5, got %.2f", plan.Scale)
+	}
+	if len(plan.Dropped) != 0 {
+		t.Errorf("Expected no keyframes dropped, got %v", plan.Dropped)
+	}
+	if plan.Estimate > 1100 {
+		t.Errorf("Estimate %d exceeds budget", plan.Estimate)
+	}
+}
+
+func TestPlanBudgetDropsLeastDissimilar(t *testing.T) {
+	dissimilarity := []float64{0.1, 0.9, 0.2, 0.8, 0.3}
+	// At the minimum scale 0.25 each image is 320x180 = 77 tokens
+	plan := PlanBudget(100+3*77, 100, dissimilarity, 1280, 720, 0.5)
+
+	if plan.Scale != MinBudgetScale {
+		t.Errorf("Expected minimum scale, got %.2f", plan.Scale)
+	}
+
+	// First frame is always kept, then the two most dissimilar, in order
+	expectedKeep := []int{0, 1, 3}
+	if len(plan.Keep) != len(expectedKeep) {
+		t.Fatalf("Expected keep %v, got %v", expectedKeep, plan.Keep)
+	}
+	for i, idx := range expectedKeep {
+		if plan.Keep[i] != idx {
+			t.Errorf("Expected keep %v, got %v", expectedKeep, plan.Keep)
+			break
+		}
+	}
+	if len(plan.Dropped) != 2 || plan.Dropped[0] != 2 || plan.Dropped[1] != 4 {
+		t.Errorf("Expected dropped [2 4], got %v", plan.Dropped)
+	}
+	if plan.Estimate > 100+3*77 {
+		t.Errorf("Estimate %d exceeds budget", plan.Estimate)
+	}
+}
+
+func TestPlanBudgetTranscriptExceedsBudget(t *testing.T) {
+	plan := PlanBudget(500, 800, []float64{1, 0.5}, 1280, 720, 0.5)
+
+	if len(plan.Keep) != 0 || len(plan.Dropped) != 2 {
+		t.Errorf("Expected every keyframe dropped, got keep=%v dropped=%v", plan.Keep, plan.Dropped)
+	}
+}
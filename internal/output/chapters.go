@@ -0,0 +1,171 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// chapterData is a section of the markdown for one chapter of the input
+type chapterData struct {
+	Number  int
+	Heading string
+	// Anchor is the heading's link target, as GitHub and most renderers
+	// generate it
+	Anchor    string
+	Segments  []segmentData
+	Keyframes []keyframeData
+	Scenes    []sceneData
+}
+
+// chapterSpan is a chapter with its end resolved
+type chapterSpan struct {
+	Chapter
+	end time.Duration
+}
+
+// buildChapters groups the transcript segments and keyframes by the chapter
+// they start in. Speech or frames before the first chapter get a section of
+// their own. Chapters outside the processed ranges are left out. keyframes
+// must correspond to result.Keyframes.
+func buildChapters(result Result, keyframes []keyframeData) []chapterData {
+	if result.Media == nil || len(result.Media.Chapters) == 0 {
+		return nil
+	}
+	spans := chapterSpans(result.Media.Chapters, result.Duration)
+
+	// Section 0 holds anything before the first chapter
+	segments := make([][]Segment, len(spans)+1)
+	frames := make([][]Keyframe, len(spans)+1)
+	frameData := make([][]keyframeData, len(spans)+1)
+	for _, seg := range result.Segments {
+		k := chapterAt(spans, seg.Start) + 1
+		segments[k] = append(segments[k], seg)
+	}
+	for i, kf := range result.Keyframes {
+		k := chapterAt(spans, kf.Timestamp) + 1
+		frames[k] = append(frames[k], kf)
+		frameData[k] = append(frameData[k], keyframes[i])
+	}
+
+	var chapters []chapterData
+	var onScreen *keyframeData
+	anchors := make(map[string]int)
+	for k := range segments {
+		var heading string
+		var start, end time.Duration
+		if k == 0 {
+			if len(segments[0]) == 0 && len(frames[0]) == 0 {
+				continue
+			}
+			end = spans[0].Start
+			heading = fmt.Sprintf("Before first chapter (%s–%s)", formatDuration(0), formatDuration(end))
+		} else {
+			span := spans[k-1]
+			if !overlapsRanges(span.Start, span.end, result.Ranges) {
+				continue
+			}
+			start, end = span.Start, span.end
+			times := fmt.Sprintf("(%s–%s)", formatDuration(start), formatDuration(end))
+			if span.Title != "" {
+				heading = "Chapter: " + span.Title + " " + times
+			} else {
+				heading = fmt.Sprintf("Chapter %d %s", k, times)
+			}
+		}
+
+		chapter := chapterData{
+			Number:    len(chapters) + 1,
+			Heading:   heading,
+			Anchor:    uniqueAnchor(anchors, heading),
+			Keyframes: frameData[k],
+		}
+		for _, seg := range segments[k] {
+			chapter.Segments = append(chapter.Segments, newSegmentData(seg, result))
+		}
+		if result.Layout == LayoutStoryboard {
+			section := Result{
+				Duration:      end,
+				Keyframes:     frames[k],
+				Segments:      segments[k],
+				Ranges:        result.Ranges,
+				LowConfidence: result.LowConfidence,
+				Speakers:      result.Speakers,
+			}
+			chapter.Scenes = buildScenesFrom(section, frameData[k], start, onScreen)
+		}
+		if n := len(frameData[k]); n > 0 {
+			onScreen = &frameData[k][n-1]
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	return chapters
+}
+
+// chapterSpans fills in chapter ends that are missing: the next chapter's
+// start, or the end of the input
+func chapterSpans(chapters []Chapter, duration time.Duration) []chapterSpan {
+	spans := make([]chapterSpan, len(chapters))
+	for i, c := range chapters {
+		end := c.End
+		if end <= c.Start {
+			end = duration
+			if i+1 < len(chapters) {
+				end = chapters[i+1].Start
+			}
+		}
+		spans[i] = chapterSpan{Chapter: c, end: end}
+	}
+	return spans
+}
+
+// chapterAt returns the position of the last chapter starting at or before
+// t, or -1 if t is before the first chapter
+func chapterAt(spans []chapterSpan, t time.Duration) int {
+	k := -1
+	for i, span := range spans {
+		if span.Start <= t {
+			k = i
+		}
+	}
+	return k
+}
+
+// overlapsRanges reports whether start to end overlaps any processed range.
+// No ranges means the whole input was processed.
+func overlapsRanges(start, end time.Duration, ranges []TimeRange) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if start < r.End && end > r.Start {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueAnchor returns the link target of a heading: lowercased, with
+// punctuation dropped and spaces turned into hyphens. Repeated headings get
+// -1, -2 and so on, counted in seen.
+func uniqueAnchor(seen map[string]int, heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	anchor := b.String()
+
+	n := seen[anchor]
+	seen[anchor] = n + 1
+	if n > 0 {
+		return fmt.Sprintf("%s-%d", anchor, n)
+	}
+	return anchor
+}
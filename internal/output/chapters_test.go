@@ -0,0 +1,150 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func chapterResult() Result {
+	return Result{
+		InputPath: "/path/to/talk.mp4",
+		Duration:  3 * time.Minute,
+		Keyframes: []Keyframe{
+			{Index: 1, Timestamp: 0, Path: "/path/to/talk_memorex_frames/frame_0001.jpg"},
+			{Index: 70, Timestamp: 70 * time.Second, Path: "/path/to/talk_memorex_frames/frame_0070.jpg"},
+		},
+		Segments: []Segment{
+			{Start: 0, Text: "Hello"},
+			{Start: 50 * time.Second, Text: "Agenda"},
+			{Start: 75 * time.Second, Text: "Demo"},
+			{Start: 140 * time.Second, Text: "Wrap up"},
+		},
+		Media: &Media{Chapters: []Chapter{
+			{Start: 10 * time.Second, End: time.Minute, Title: "Intro"},
+			{Start: time.Minute, End: 2 * time.Minute, Title: "Demo"},
+			{Start: 2 * time.Minute}, // Untitled, end left to the input's
+		}},
+	}
+}
+
+func TestBuildChapters(t *testing.T) {
+	result := chapterResult()
+	chapters := buildChapters(result, []keyframeData{{Index: 1}, {Index: 70}})
+
+	want := []struct {
+		heading   string
+		anchor    string
+		segments  int
+		keyframes int
+	}{
+		{"Before first chapter (0:00–0:10)", "before-first-chapter-000010", 1, 1},
+		{"Chapter: Intro (0:10–1:00)", "chapter-intro-010100", 1, 0},
+		{"Chapter: Demo (1:00–2:00)", "chapter-demo-100200", 1, 1},
+		{"Chapter 3 (2:00–3:00)", "chapter-3-200300", 1, 0},
+	}
+	if len(chapters) != len(want) {
+		t.Fatalf("Expected %d chapters, got %d: %+v", len(want), len(chapters), chapters)
+	}
+	for i, w := range want {
+		c := chapters[i]
+		if c.Number != i+1 || c.Heading != w.heading || c.Anchor != w.anchor {
+			t.Errorf("Chapter %d = %d %q #%s, want %d %q #%s", i, c.Number, c.Heading, c.Anchor, i+1, w.heading, w.anchor)
+		}
+		if len(c.Segments) != w.segments || len(c.Keyframes) != w.keyframes {
+			t.Errorf("Chapter %q has %d segments and %d keyframes, want %d and %d",
+				c.Heading, len(c.Segments), len(c.Keyframes), w.segments, w.keyframes)
+		}
+	}
+}
+
+func TestBuildChaptersNone(t *testing.T) {
+	result := chapterResult()
+	result.Media.Chapters = nil
+	if chapters := buildChapters(result, nil); chapters != nil {
+		t.Errorf("Expected no chapters, got %+v", chapters)
+	}
+	result.Media = nil
+	if chapters := buildChapters(result, nil); chapters != nil {
+		t.Errorf("Expected no chapters without media, got %+v", chapters)
+	}
+}
+
+func TestBuildChaptersRanges(t *testing.T) {
+	result := chapterResult()
+	result.Ranges = []TimeRange{{Start: 70 * time.Second, End: 80 * time.Second}}
+	result.Keyframes = result.Keyframes[1:]
+	result.Segments = result.Segments[2:3]
+
+	chapters := buildChapters(result, []keyframeData{{Index: 70}})
+	if len(chapters) != 1 || chapters[0].Heading != "Chapter: Demo (1:00–2:00)" {
+		t.Errorf("Expected only the processed chapter, got %+v", chapters)
+	}
+}
+
+func TestBuildChaptersStoryboard(t *testing.T) {
+	result := chapterResult()
+	result.Layout = LayoutStoryboard
+	chapters := buildChapters(result, []keyframeData{{Index: 1}, {Index: 70}})
+
+	// Frame 1 is still on screen when Intro starts
+	intro := chapters[1].Scenes
+	if len(intro) != 1 || !intro[0].Continued || intro[0].Keyframe.Index != 1 {
+		t.Fatalf("Expected Intro to continue Frame 1, got %+v", intro)
+	}
+	if intro[0].StartStr != "0:10" || intro[0].EndStr != "1:00" {
+		t.Errorf("Expected continued scene 0:10–1:00, got %s–%s", intro[0].StartStr, intro[0].EndStr)
+	}
+
+	// Nothing is said before Frame 70, and its scene ends with the chapter
+	demo := chapters[2].Scenes
+	if len(demo) != 1 || demo[0].Keyframe.Index != 70 || demo[0].EndStr != "2:00" {
+		t.Errorf("Expected Demo to show Frame 70 up to 2:00, got %+v", demo)
+	}
+}
+
+func TestWriteMarkdownChapters(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "talk_memorex.md")
+	if err := WriteMarkdown(outputPath, chapterResult()); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	for _, want := range []string{
+		"## Contents\n\n1. [Before first chapter (0:00–0:10)](#before-first-chapter-000010)\n",
+		"3. [Chapter: Demo (1:00–2:00)](#chapter-demo-100200)\n",
+		"## Chapter: Demo (1:00–2:00)\n\n[1:15] Demo\n\n### Frame 70 (1:10)\n",
+		"## Chapter 3 (2:00–3:00)\n\n[2:20] Wrap up\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Output missing expected content: %q", want)
+		}
+	}
+	for _, unwanted := range []string{"## Transcript", "## Keyframes"} {
+		if strings.Contains(string(content), unwanted) {
+			t.Errorf("Chapters should replace %s", unwanted)
+		}
+	}
+}
+
+func TestUniqueAnchor(t *testing.T) {
+	seen := make(map[string]int)
+	tests := []struct {
+		heading string
+		want    string
+	}{
+		{"Chapter: Q&A (1:00–2:00)", "chapter-qa-100200"},
+		{"Chapter: Q&A (1:00–2:00)", "chapter-qa-100200-1"},
+		{"Chapter: Über_alles", "chapter-über_alles"},
+	}
+	for _, tt := range tests {
+		if got := uniqueAnchor(seen, tt.heading); got != tt.want {
+			t.Errorf("uniqueAnchor(%q) = %q, want %q", tt.heading, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// IndexEntry describes one processed file in a batch index
+type IndexEntry struct {
+	InputPath  string
+	OutputPath string
+	Duration   time.Duration
+	Keyframes  int
+	Segments   int
+	Tokens     int
+	Error      string // Non-empty if processing failed
+}
+
+const indexTemplate = `# Memorex Index
+
+- Files: {{.FileCount}}
+- Failed: {{.FailedCount}}
+- Total duration: {{.DurationStr}}
+- Total token estimate: ~{{.Tokens}}
+
+| File | Duration | Keyframes | Segments | Tokens | Result |
+|------|----------|-----------|----------|--------|--------|
+{{range .Entries}}{{if .Error}}| {{.Filename}} | | | | | Failed: {{.Error}} |
+{{else}}| {{.Filename}} | {{.DurationStr}} | {{.Keyframes}} | {{.Segments}} | ~{{.Tokens}} | [{{.OutputName}}]({{.RelPath}}) |
+{{end}}{{end}}`
+
+type indexData struct {
+	FileCount   int
+	FailedCount int
+	DurationStr string
+	Tokens      int
+	Entries     []indexEntryData
+}
+
+type indexEntryData struct {
+	Filename    string
+	DurationStr string
+	Keyframes   int
+	Segments    int
+	Tokens      int
+	OutputName  string
+	RelPath     string
+	Error       string
+}
+
+// WriteIndex writes a markdown index linking to each file's result
+func WriteIndex(indexPath string, entries []IndexEntry) error {
+	data := indexData{FileCount: len(entries)}
+
+	var total time.Duration
+	indexDir := filepath.Dir(indexPath)
+	for _, e := range entries {
+		entry := indexEntryData{
+			Filename: escapeTableCell(InputName(e.InputPath)),
+			Error:    escapeTableCell(e.Error),
+		}
+		if e.Error != "" {
+			data.FailedCount++
+			data.Entries = append(data.Entries, entry)
+			continue
+		}
+
+		relPath, err := filepath.Rel(indexDir, e.OutputPath)
+		if err != nil {
+			relPath = e.OutputPath // Fall back to absolute path
+		}
+		entry.DurationStr = formatDuration(e.Duration)
+		entry.Keyframes = e.Keyframes
+		entry.Segments = e.Segments
+		entry.Tokens = e.Tokens
+		entry.OutputName = escapeTableCell(filepath.Base(e.OutputPath))
+		entry.RelPath = filepath.ToSlash(relPath)
+		data.Entries = append(data.Entries, entry)
+
+		total += e.Duration
+		data.Tokens += e.Tokens
+	}
+	data.DurationStr = formatDuration(total)
+
+	tmpl, err := template.New("index").Parse(indexTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	file, err := os.Create(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to create index file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if err := tmpl.Execute(file, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return file.Close()
+}
+
+// escapeTableCell makes text safe to place in a markdown table cell
+func escapeTableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
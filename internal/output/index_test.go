@@ -0,0 +1,60 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	indexPath := filepath.Join(tempDir, "index.md")
+
+	entries := []IndexEntry{
+		{
+			InputPath:  "/videos/standup.mp4",
+			OutputPath: filepath.Join(tempDir, "out", "standup_memorex.md"),
+			Duration:   90 * time.Second,
+			Keyframes:  4,
+			Segments:   12,
+			Tokens:     3200,
+		},
+		{
+			InputPath: "/videos/broken|name.mov",
+			Error:     "frame extraction failed",
+		},
+	}
+
+	if err := WriteIndex(indexPath, entries); err != nil {
+		t.Fatalf("WriteIndex failed: %v", err)
+	}
+
+	content, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	contentStr := string(content)
+
+	checks := []string{
+		"# Memorex Index",
+		"- Files: 2",
+		"- Failed: 1",
+		"- Total duration: 1:30",
+		"- Total token estimate: ~3200",
+		"| standup.mp4 | 1:30 | 4 | 12 | ~3200 | [standup_memorex.md](out/standup_memorex.md) |",
+		`| broken\|name.mov | | | | | Failed: frame extraction failed |`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(contentStr, check) {
+			t.Errorf("Index missing expected content: %s\n%s", check, contentStr)
+		}
+	}
+}
+
+func TestWriteIndexInvalidPath(t *testing.T) {
+	if err := WriteIndex("/nonexistent/directory/index.md", nil); err == nil {
+		t.Error("Expected error for invalid index path")
+	}
+}
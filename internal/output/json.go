@@ -0,0 +1,256 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON output schema. It is bumped
+// whenever a field is removed or changes meaning; new fields may be added
+// without a version change.
+const SchemaVersion = 1
+
+// jsonDocument is the top-level structure of the JSON output
+type jsonDocument struct {
+	Schema        string         `json:"schema"`
+	SchemaVersion int            `json:"schema_version"`
+	Input         jsonInput      `json:"input"`
+	TokenEstimate int            `json:"token_estimate"`
+	Tokens        TokenBreakdown `json:"token_breakdown"`
+	Segments      []jsonSegment  `json:"segments"`
+	Keyframes     []jsonKeyframe `json:"keyframes"`
+	// Transcript describes the transcript's language, if known
+	Transcript *jsonTranscript `json:"transcript,omitempty"`
+}
+
+type jsonTranscript struct {
+	Language string `json:"language"`
+	// Detected is set when whisper detected the language
+	Detected bool `json:"detected,omitempty"`
+	// Translated is set when the speech was translated to English
+	Translated bool `json:"translated,omitempty"`
+}
+
+type jsonInput struct {
+	Path        string `json:"path"`
+	Filename    string `json:"filename"`
+	DurationMs  int64  `json:"duration_ms"`
+	TotalFrames int    `json:"total_frames"`
+	// Ranges lists the processed parts of the input, if not all of it
+	Ranges []jsonRange `json:"ranges,omitempty"`
+	// Media describes the container and streams, if the input was probed
+	Media *jsonMedia `json:"media,omitempty"`
+}
+
+type jsonMedia struct {
+	Container    string           `json:"container,omitempty"`
+	Title        string           `json:"title,omitempty"`
+	CreationTime string           `json:"creation_time,omitempty"` // RFC 3339
+	BitRate      int64            `json:"bit_rate,omitempty"`
+	Video        *jsonVideoStream `json:"video"` // null if there is no video
+	Audio        *jsonAudioStream `json:"audio"` // null if there is no audio
+	Chapters     []jsonChapter    `json:"chapters,omitempty"`
+}
+
+type jsonVideoStream struct {
+	Codec     string  `json:"codec"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	FrameRate float64 `json:"frame_rate,omitempty"`
+	Rotation  int     `json:"rotation,omitempty"`
+}
+
+type jsonAudioStream struct {
+	Codec         string `json:"codec"`
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channel_layout,omitempty"`
+	SampleRate    int    `json:"sample_rate,omitempty"`
+}
+
+type jsonChapter struct {
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+	Title   string `json:"title,omitempty"`
+}
+
+type jsonRange struct {
+	StartMs int64 `json:"start_ms"`
+	EndMs   int64 `json:"end_ms"`
+}
+
+type jsonSegment struct {
+	StartMs    int64   `json:"start_ms"`
+	EndMs      int64   `json:"end_ms"`
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence,omitempty"`
+	// Speaker is the speaker's label with --diarize
+	Speaker string `json:"speaker,omitempty"`
+	// Words are left out when whisper didn't time them
+	Words []jsonWord `json:"words,omitempty"`
+}
+
+type jsonWord struct {
+	StartMs     int64   `json:"start_ms"`
+	EndMs       int64   `json:"end_ms"`
+	Text        string  `json:"text"`
+	Probability float64 `json:"probability"`
+}
+
+type jsonKeyframe struct {
+	Index       int   `json:"index"`
+	TimestampMs int64 `json:"timestamp_ms"`
+	// ImageTimestampMs is set when the saved image is from later in the change
+	ImageTimestampMs *int64 `json:"image_timestamp_ms,omitempty"`
+	Path             string `json:"path"`
+	// DuplicateOf is the index of an earlier keyframe with the same image,
+	// whose path this keyframe shares
+	DuplicateOf int `json:"duplicate_of,omitempty"`
+}
+
+// WriteJSON serializes the result as versioned JSON to the output file.
+// Keyframe paths are written relative to the output file, matching the
+// markdown output.
+func WriteJSON(outputPath string, result Result) error {
+	doc := buildJSONDocument(outputPath, result)
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := os.WriteFile(outputPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return nil
+}
+
+// JSONSidecarPath returns the path of the JSON file written alongside a
+// markdown output file
+func JSONSidecarPath(markdownPath string) string {
+	return strings.TrimSuffix(markdownPath, filepath.Ext(markdownPath)) + ".json"
+}
+
+func buildJSONDocument(outputPath string, result Result) jsonDocument {
+	doc := jsonDocument{
+		Schema:        "memorex",
+		SchemaVersion: SchemaVersion,
+		Input: jsonInput{
+			Path:        result.InputPath,
+			Filename:    InputName(result.InputPath),
+			DurationMs:  result.Duration.Milliseconds(),
+			TotalFrames: result.TotalFrames,
+		},
+		TokenEstimate: EstimateTokens(result),
+		Tokens:        EstimateTokenBreakdown(result),
+		Segments:      make([]jsonSegment, 0, len(result.Segments)),
+		Keyframes:     make([]jsonKeyframe, 0, len(result.Keyframes)),
+	}
+
+	for _, r := range result.Ranges {
+		doc.Input.Ranges = append(doc.Input.Ranges, jsonRange{
+			StartMs: r.Start.Milliseconds(),
+			EndMs:   r.End.Milliseconds(),
+		})
+	}
+
+	doc.Input.Media = newJSONMedia(result.Media)
+	if result.Language != "" {
+		doc.Transcript = &jsonTranscript{
+			Language:   result.Language,
+			Detected:   result.LanguageDetected,
+			Translated: result.Translated,
+		}
+	}
+
+	for _, seg := range result.Segments {
+		segment := jsonSegment{
+			StartMs:    seg.Start.Milliseconds(),
+			EndMs:      seg.End.Milliseconds(),
+			Text:       strings.TrimSpace(seg.Text),
+			Confidence: roundProbability(seg.Confidence),
+			Speaker:    speakerLabel(result.Speakers, seg.Speaker),
+		}
+		for _, w := range seg.Words {
+			segment.Words = append(segment.Words, jsonWord{
+				StartMs:     w.Start.Milliseconds(),
+				EndMs:       w.End.Milliseconds(),
+				Text:        w.Text,
+				Probability: roundProbability(w.Probability),
+			})
+		}
+		doc.Segments = append(doc.Segments, segment)
+	}
+
+	outputDir := filepath.Dir(outputPath)
+	for _, kf := range result.Keyframes {
+		relPath, err := filepath.Rel(outputDir, kf.Path)
+		if err != nil {
+			relPath = kf.Path // Fall back to absolute path
+		}
+		jkf := jsonKeyframe{
+			Index:       kf.Index,
+			TimestampMs: kf.Timestamp.Milliseconds(),
+			Path:        relPath,
+			DuplicateOf: kf.DuplicateOf,
+		}
+		if kf.ImageTimestamp > kf.Timestamp {
+			ms := kf.ImageTimestamp.Milliseconds()
+			jkf.ImageTimestampMs = &ms
+		}
+		doc.Keyframes = append(doc.Keyframes, jkf)
+	}
+
+	return doc
+}
+
+func newJSONMedia(m *Media) *jsonMedia {
+	if m == nil {
+		return nil
+	}
+
+	jm := &jsonMedia{
+		Container: m.Container,
+		Title:     m.Title,
+		BitRate:   m.BitRate,
+	}
+	if !m.CreationTime.IsZero() {
+		jm.CreationTime = m.CreationTime.UTC().Format(time.RFC3339)
+	}
+	if v := m.Video; v != nil {
+		jm.Video = &jsonVideoStream{
+			Codec:     v.Codec,
+			Width:     v.Width,
+			Height:    v.Height,
+			FrameRate: v.FrameRate,
+			Rotation:  v.Rotation,
+		}
+	}
+	if a := m.Audio; a != nil {
+		jm.Audio = &jsonAudioStream{
+			Codec:         a.Codec,
+			Channels:      a.Channels,
+			ChannelLayout: a.ChannelLayout,
+			SampleRate:    a.SampleRate,
+		}
+	}
+	for _, c := range m.Chapters {
+		jm.Chapters = append(jm.Chapters, jsonChapter{
+			StartMs: c.Start.Milliseconds(),
+			EndMs:   c.End.Milliseconds(),
+			Title:   c.Title,
+		})
+	}
+	return jm
+}
+
+// roundProbability rounds to three places, plenty to compare by
+func roundProbability(p float64) float64 {
+	return math.Round(p*1000) / 1000
+}
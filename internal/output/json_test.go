@@ -0,0 +1,259 @@
+package output
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	outputPath := filepath.Join(tempDir, "test_memorex.json")
+	framesDir := filepath.Join(tempDir, "test_memorex_frames")
+
+	result := Result{
+		InputPath:   "/path/to/video.mp4",
+		Duration:    2*time.Minute + 34*time.Second + 250*time.Millisecond,
+		TotalFrames: 154,
+		Keyframes: []Keyframe{
+			{Index: 1, Timestamp: 0, Path: filepath.Join(framesDir, "frame_0001.jpg")},
+			{Index: 15, Timestamp: 14500 * time.Millisecond, ImageTimestamp: 16 * time.Second, Path: filepath.Join(framesDir, "frame_0015.jpg")},
+		},
+		Segments: []Segment{
+			{Start: 0, End: 5200 * time.Millisecond, Text: " Hello world ", Confidence: 0.91234, Words: []Word{
+				{Text: "Hello", Start: 0, End: 2 * time.Second, Probability: 0.95},
+				{Text: "world", Start: 2 * time.Second, End: 5200 * time.Millisecond, Probability: 0.87468},
+			}},
+			{Start: 5200 * time.Millisecond, End: 10 * time.Second, Text: "This is a test", Speaker: 2},
+		},
+		Speakers: []string{"Alice", "Bob"},
+	}
+
+	if err := WriteJSON(outputPath, result); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+
+	if doc.SchemaVersion != SchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", SchemaVersion, doc.SchemaVersion)
+	}
+	if doc.Input.Filename != "video.mp4" {
+		t.Errorf("Expected filename video.mp4, got %s", doc.Input.Filename)
+	}
+	if doc.Input.DurationMs != 154250 {
+		t.Errorf("Expected duration 154250ms, got %d", doc.Input.DurationMs)
+	}
+	if doc.Input.TotalFrames != 154 {
+		t.Errorf("Expected 154 total frames, got %d", doc.Input.TotalFrames)
+	}
+	if doc.TokenEstimate != EstimateTokens(result) {
+		t.Errorf("Expected token estimate %d, got %d", EstimateTokens(result), doc.TokenEstimate)
+	}
+
+	if len(doc.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(doc.Segments))
+	}
+	if doc.Segments[0].Text != "Hello world" {
+		t.Errorf("Expected trimmed text 'Hello world', got %q", doc.Segments[0].Text)
+	}
+	if doc.Segments[0].EndMs != 5200 || doc.Segments[1].StartMs != 5200 {
+		t.Errorf("Expected millisecond segment timing, got %+v", doc.Segments)
+	}
+	if doc.Segments[0].Confidence != 0.912 {
+		t.Errorf("Expected confidence rounded to 0.912, got %v", doc.Segments[0].Confidence)
+	}
+	if strings.Count(string(content), `"confidence"`) != 1 {
+		t.Errorf("Expected unknown confidence to be left out")
+	}
+	words := doc.Segments[0].Words
+	if len(words) != 2 || words[1].StartMs != 2000 || words[1].EndMs != 5200 || words[1].Probability != 0.875 {
+		t.Errorf("Expected timed words with rounded probabilities, got %+v", words)
+	}
+	if doc.Segments[0].Speaker != "" || doc.Segments[1].Speaker != "Bob" {
+		t.Errorf("Expected only the second segment to name its speaker, got %+v", doc.Segments)
+	}
+	if doc.Segments[1].Words != nil {
+		t.Errorf("Expected no words for an untimed segment, got %+v", doc.Segments[1].Words)
+	}
+
+	if len(doc.Keyframes) != 2 {
+		t.Fatalf("Expected 2 keyframes, got %d", len(doc.Keyframes))
+	}
+	if doc.Keyframes[1].TimestampMs != 14500 {
+		t.Errorf("Expected keyframe timestamp 14500ms, got %d", doc.Keyframes[1].TimestampMs)
+	}
+	if doc.Keyframes[1].Path != filepath.Join("test_memorex_frames", "frame_0015.jpg") {
+		t.Errorf("Expected relative keyframe path, got %s", doc.Keyframes[1].Path)
+	}
+	if doc.Keyframes[0].ImageTimestampMs != nil {
+		t.Errorf("Expected no image timestamp for an unrefined keyframe, got %d", *doc.Keyframes[0].ImageTimestampMs)
+	}
+	if ts := doc.Keyframes[1].ImageTimestampMs; ts == nil || *ts != 16000 {
+		t.Errorf("Expected image timestamp 16000ms, got %v", ts)
+	}
+	if doc.Input.Ranges != nil {
+		t.Errorf("Expected no ranges when the whole input was processed, got %+v", doc.Input.Ranges)
+	}
+}
+
+func TestWriteJSONRanges(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.json")
+	result := Result{
+		InputPath: "/path/to/talk.mp4",
+		Duration:  90 * time.Minute,
+		Ranges:    []TimeRange{{Start: 12 * time.Minute, End: 18 * time.Minute}},
+	}
+
+	if err := WriteJSON(outputPath, result); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if len(doc.Input.Ranges) != 1 || doc.Input.Ranges[0] != (jsonRange{StartMs: 720000, EndMs: 1080000}) {
+		t.Errorf("Unexpected ranges: %+v", doc.Input.Ranges)
+	}
+}
+
+func TestWriteJSONMedia(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.json")
+	result := Result{
+		InputPath: "podcast.mp3",
+		Media: &Media{
+			Container:    "mp3",
+			CreationTime: time.Date(2024, 3, 1, 14, 5, 0, 0, time.UTC),
+			Audio:        &AudioStream{Codec: "mp3", Channels: 2, SampleRate: 44100},
+			Chapters:     []Chapter{{Start: 0, End: 90 * time.Second, Title: "Intro"}},
+		},
+	}
+
+	if err := WriteJSON(outputPath, result); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	media := doc.Input.Media
+	if media == nil {
+		t.Fatal("Expected input.media")
+	}
+	if media.Container != "mp3" || media.CreationTime != "2024-03-01T14:05:00Z" {
+		t.Errorf("Unexpected media: %+v", media)
+	}
+	if media.Video != nil {
+		t.Errorf("Expected no video stream, got %+v", media.Video)
+	}
+	if media.Audio == nil || *media.Audio != (jsonAudioStream{Codec: "mp3", Channels: 2, SampleRate: 44100}) {
+		t.Errorf("Unexpected audio: %+v", media.Audio)
+	}
+	if len(media.Chapters) != 1 || media.Chapters[0] != (jsonChapter{StartMs: 0, EndMs: 90000, Title: "Intro"}) {
+		t.Errorf("Unexpected chapters: %+v", media.Chapters)
+	}
+
+	// A missing stream is null rather than left out
+	if !strings.Contains(string(content), `"video": null`) {
+		t.Errorf("Expected \"video\": null in output")
+	}
+}
+
+func TestWriteJSONLanguage(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.json")
+	result := Result{InputPath: "call.mp4", Language: "es", LanguageDetected: true, Translated: true}
+
+	if err := WriteJSON(outputPath, result); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	want := jsonTranscript{Language: "es", Detected: true, Translated: true}
+	if doc.Transcript == nil || *doc.Transcript != want {
+		t.Errorf("Transcript = %+v, want %+v", doc.Transcript, want)
+	}
+
+	// Without a known language the object is left out
+	doc = buildJSONDocument(outputPath, Result{InputPath: "call.mp4"})
+	if doc.Transcript != nil {
+		t.Errorf("Expected no transcript object, got %+v", doc.Transcript)
+	}
+}
+
+func TestWriteJSONEmptyLists(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.json")
+
+	if err := WriteJSON(outputPath, Result{InputPath: "audio.mp3"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	// Empty lists should serialize as [] rather than null
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"segments", "keyframes"} {
+		if string(raw[key]) != "[]" {
+			t.Errorf("Expected %s to be [], got %s", key, raw[key])
+		}
+	}
+}
+
+func TestJSONSidecarPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"video_memorex.md", "video_memorex.json"},
+		{"/tmp/out/analysis.md", "/tmp/out/analysis.json"},
+		{"noext", "noext.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := JSONSidecarPath(tt.input); got != tt.expected {
+				t.Errorf("JSONSidecarPath(%s) = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteJSONInvalidPath(t *testing.T) {
+	err := WriteJSON("/nonexistent/directory/test.json", Result{InputPath: "test.mp4"})
+	if err == nil {
+		t.Error("Expected error for invalid output path")
+	}
+}
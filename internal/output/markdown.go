@@ -3,7 +3,9 @@ package output
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"text/template"
@@ -13,8 +15,23 @@ import (
 // Keyframe represents a keyframe for output
 type Keyframe struct {
 	Index     int
-	Timestamp time.Duration
-	Path      string
+	Timestamp time.Duration // When the change was detected
+	// ImageTimestamp is when the saved image was taken, if later than
+	// Timestamp because a sharper or more stable frame was picked
+	ImageTimestamp time.Duration
+	Path           string
+	Width          int // Saved image width in pixels, 0 if unknown
+	Height         int // Saved image height in pixels, 0 if unknown
+	// DuplicateOf is the Index of an earlier keyframe showing the same
+	// image, 0 if this keyframe is not a repeat. Repeats share the earlier
+	// keyframe's Path and cost no image tokens.
+	DuplicateOf int
+}
+
+// TimeRange is a part of the input that was processed
+type TimeRange struct {
+	Start time.Duration
+	End   time.Duration
 }
 
 // Segment represents a transcript segment for output
@@ -22,6 +39,41 @@ type Segment struct {
 	Start time.Duration
 	End   time.Duration
 	Text  string
+	// Confidence is whisper's mean token probability, 0 if unknown
+	Confidence float64
+	Words      []Word // nil if whisper didn't time the words
+	// Speaker numbers the voice from 1 when the transcript was diarized, 0
+	// if unknown
+	Speaker int
+}
+
+// Word is a transcribed word with its timing
+type Word struct {
+	Text        string
+	Start       time.Duration
+	End         time.Duration
+	Probability float64 // 0 to 1
+}
+
+// Layout controls how the transcript and keyframes are arranged in the markdown
+type Layout string
+
+const (
+	// LayoutStandard lists the full transcript followed by all keyframes
+	LayoutStandard Layout = "standard"
+	// LayoutStoryboard interleaves each keyframe with the transcript segments
+	// spoken while it was on screen
+	LayoutStoryboard Layout = "storyboard"
+)
+
+// ParseLayout validates a markdown layout name
+func ParseLayout(name string) (Layout, error) {
+	switch l := Layout(strings.ToLower(name)); l {
+	case LayoutStandard, LayoutStoryboard:
+		return l, nil
+	default:
+		return "", fmt.Errorf("unsupported layout %q: must be standard or storyboard", name)
+	}
 }
 
 // Result contains all data for markdown generation
@@ -31,17 +83,53 @@ type Result struct {
 	TotalFrames int
 	Keyframes   []Keyframe
 	Segments    []Segment
+	Layout      Layout // Defaults to LayoutStandard
+	// Ranges are the parts of the input that were processed, in order; nil
+	// means all of it. Timestamps stay relative to the start of the input.
+	Ranges []TimeRange
+	// Media describes the input's streams, nil if it couldn't be probed
+	Media *Media
+	// Language is the code of the spoken language, if known.
+	// LanguageDetected is set when whisper detected it rather than being
+	// told, and Translated when the transcript was translated to English.
+	Language         string
+	LanguageDetected bool
+	Translated       bool
+	// LowConfidence marks transcript words whisper gave a lower probability
+	// than this as [?word?]; 0 marks none
+	LowConfidence float64
+	// Speakers names segment speakers in order: Speakers[0] is Speaker 1.
+	// Speakers without a name are labeled "Speaker N".
+	Speakers []string
 }
 
 const markdownTemplate = `# Video Analysis: {{.Filename}}
 
 ## Metadata
 - Duration: {{.DurationStr}}
-- Original frames: {{.TotalFrames}}
-- Keyframes extracted: {{.KeyframeCount}}
-- Token estimate: ~{{.TokenEstimate}}
+{{range .MediaLines}}- {{.}}
+{{end}}{{if .RangesStr}}- Processed: {{.RangesStr}}
+{{end}}{{if .LanguageStr}}- Language: {{.LanguageStr}}
+{{end}}- Original frames: {{.TotalFrames}}
+- Keyframes extracted: {{.KeyframeCount}}{{if .RepeatCount}} ({{.RepeatCount}} repeats of earlier frames){{end}}
+- Token estimate: ~{{.Tokens.Total}} (metadata ~{{.Tokens.Metadata}}, transcript ~{{.Tokens.Transcript}}, images ~{{.Tokens.Images}})
 
-{{if .Segments}}
+{{if .Chapters}}
+## Contents
+
+{{range .Chapters}}{{.Number}}. [{{.Heading}}](#{{.Anchor}})
+{{end}}
+{{range .Chapters}}## {{.Heading}}
+
+{{if $.Storyboard}}{{range .Scenes}}{{template "scene" .}}{{end}}{{else}}{{if .Segments}}{{range .Segments}}[{{.StartStr}}] {{.Text}}
+{{end}}
+{{end}}{{range .Keyframes}}### Frame {{.Index}} ({{.TimestampStr}})
+{{template "image" .}}
+{{end}}{{end}}{{end}}{{else if .Storyboard}}
+## Storyboard
+
+{{range .Scenes}}{{template "scene" .}}{{end}}
+{{else}}{{if .Segments}}
 ## Transcript
 
 {{range .Segments}}[{{.StartStr}}] {{.Text}}
@@ -51,20 +139,39 @@ const markdownTemplate = `# Video Analysis: {{.Filename}}
 ## Keyframes
 
 {{range .Keyframes}}### Frame {{.Index}} ({{.TimestampStr}})
-![Frame at {{.TimestampStr}}]({{.RelPath}})
-
+{{template "image" .}}
 {{end}}
-{{end}}`
+{{end}}{{end}}
+{{- define "scene"}}{{if .Continued}}### Frame {{.Keyframe.Index}}, continued ({{.StartStr}}–{{.EndStr}})
+{{else if .Keyframe}}### Frame {{.Keyframe.Index}} ({{.StartStr}}–{{.EndStr}})
+{{template "image" .Keyframe}}{{else}}### Before first frame ({{.StartStr}}–{{.EndStr}})
+{{end}}
+{{range .Segments}}[{{.StartStr}}] {{.Text}}
+{{end}}
+{{end}}
+{{- define "image"}}{{if .DuplicateOf}}Same as Frame {{.DuplicateOf}} (on screen at {{.SeenAtStr}})
+{{else}}![Frame at {{.TimestampStr}}]({{.RelPath}})
+{{if .SeenAtStr}}On screen at {{.SeenAtStr}}
+{{end}}{{end}}{{end}}`
 
 // templateData holds processed data for the template
 type templateData struct {
 	Filename      string
 	DurationStr   string
+	MediaLines    []string
+	LanguageStr   string
+	RangesStr     string
 	TotalFrames   int
 	KeyframeCount int
-	TokenEstimate int
+	RepeatCount   int
+	Tokens        TokenBreakdown
 	Segments      []segmentData
 	Keyframes     []keyframeData
+	Storyboard    bool
+	Scenes        []sceneData
+	// Chapters replace the transcript and keyframe sections when the input
+	// has chapter markers
+	Chapters []chapterData
 }
 
 type segmentData struct {
@@ -72,45 +179,81 @@ type segmentData struct {
 	Text     string
 }
 
+// sceneData groups the transcript segments spoken while a keyframe was on screen
+type sceneData struct {
+	Keyframe *keyframeData // nil for speech before the first keyframe
+	// Continued marks a scene whose keyframe came up in an earlier chapter
+	Continued bool
+	StartStr  string
+	EndStr    string
+	Segments  []segmentData
+}
+
 type keyframeData struct {
 	Index        int
 	TimestampStr string
 	RelPath      string
+	DuplicateOf  int
+	// SeenAtStr lists every time the image was on screen, if it repeats
+	SeenAtStr string
 }
 
 // WriteMarkdown generates and writes the markdown output file
 func WriteMarkdown(outputPath string, result Result) error {
 	// Prepare template data
 	data := templateData{
-		Filename:      filepath.Base(result.InputPath),
+		Filename:      InputName(result.InputPath),
 		DurationStr:   formatDuration(result.Duration),
+		MediaLines:    result.Media.metadataLines(),
+		LanguageStr:   languageString(result),
 		TotalFrames:   result.TotalFrames,
 		KeyframeCount: len(result.Keyframes),
-		TokenEstimate: EstimateTokens(result),
+		Tokens:        EstimateTokenBreakdown(result),
 	}
 
+	ranges := make([]string, len(result.Ranges))
+	for i, r := range result.Ranges {
+		if r.End > r.Start {
+			ranges[i] = formatDuration(r.Start) + "–" + formatDuration(r.End)
+		} else {
+			ranges[i] = "from " + formatDuration(r.Start) // Duration unknown
+		}
+	}
+	data.RangesStr = strings.Join(ranges, ", ")
+
 	// Process segments
 	for _, seg := range result.Segments {
-		data.Segments = append(data.Segments, segmentData{
-			StartStr: formatDuration(seg.Start),
-			Text:     strings.TrimSpace(seg.Text),
-		})
+		data.Segments = append(data.Segments, newSegmentData(seg, result))
 	}
 
 	// Process keyframes with relative paths
 	outputDir := filepath.Dir(outputPath)
+	seenAt := appearances(result.Keyframes)
 	for _, kf := range result.Keyframes {
 		relPath, err := filepath.Rel(outputDir, kf.Path)
 		if err != nil {
 			relPath = kf.Path // Fall back to absolute path
 		}
+		original := kf.Index
+		if kf.DuplicateOf != 0 {
+			original = kf.DuplicateOf
+			data.RepeatCount++
+		}
 		data.Keyframes = append(data.Keyframes, keyframeData{
 			Index:        kf.Index,
 			TimestampStr: formatDuration(kf.Timestamp),
 			RelPath:      relPath,
+			DuplicateOf:  kf.DuplicateOf,
+			SeenAtStr:    seenAt[original],
 		})
 	}
 
+	data.Storyboard = result.Layout == LayoutStoryboard
+	data.Chapters = buildChapters(result, data.Keyframes)
+	if data.Storyboard && data.Chapters == nil {
+		data.Scenes = buildScenes(result, data.Keyframes)
+	}
+
 	// Parse and execute template
 	tmpl, err := template.New("markdown").Parse(markdownTemplate)
 	if err != nil {
@@ -130,6 +273,179 @@ func WriteMarkdown(outputPath string, result Result) error {
 	return file.Close()
 }
 
+// languageString describes the transcript's language, such as "es (detected,
+// translated to English)"
+func languageString(result Result) string {
+	if result.Language == "" {
+		return ""
+	}
+
+	var notes []string
+	if result.LanguageDetected {
+		notes = append(notes, "detected")
+	}
+	if result.Translated {
+		notes = append(notes, "translated to English")
+	}
+	if len(notes) == 0 {
+		return result.Language
+	}
+	return result.Language + " (" + strings.Join(notes, ", ") + ")"
+}
+
+// appearances lists the times each repeated image was on screen, keyed by the
+// Index of its first keyframe. Images shown only once are left out.
+func appearances(keyframes []Keyframe) map[int]string {
+	times := make(map[int][]string)
+	for _, kf := range keyframes {
+		original := kf.Index
+		if kf.DuplicateOf != 0 {
+			original = kf.DuplicateOf
+		}
+		times[original] = append(times[original], formatDuration(kf.Timestamp))
+	}
+
+	seenAt := make(map[int]string)
+	for index, t := range times {
+		if len(t) > 1 {
+			seenAt[index] = strings.Join(t, ", ")
+		}
+	}
+	return seenAt
+}
+
+// buildScenes assigns each transcript segment to the keyframe that was on
+// screen when the segment started. Each scene spans from its keyframe to the
+// next one (or the end of the video).
+func buildScenes(result Result, keyframes []keyframeData) []sceneData {
+	return buildScenesFrom(result, keyframes, 0, nil)
+}
+
+// buildScenesFrom builds the scenes of a section of the video starting at
+// start and ending at result.Duration. Speech before the section's first
+// keyframe goes with carried, the keyframe still on screen from before the
+// section, if any.
+func buildScenesFrom(result Result, keyframes []keyframeData, start time.Duration, carried *keyframeData) []sceneData {
+	var scenes []sceneData
+
+	// Speech before the first keyframe gets a scene without an image
+	var leading []segmentData
+	firstFrame := result.Duration
+	if len(result.Keyframes) > 0 {
+		firstFrame = result.Keyframes[0].Timestamp
+	}
+	for _, seg := range result.Segments {
+		if seg.Start < firstFrame || len(result.Keyframes) == 0 {
+			leading = append(leading, newSegmentData(seg, result))
+		}
+	}
+	if len(leading) > 0 {
+		scenes = append(scenes, sceneData{
+			Keyframe:  carried,
+			Continued: carried != nil,
+			StartStr:  formatDuration(start),
+			EndStr:    formatDuration(firstFrame),
+			Segments:  leading,
+		})
+	}
+
+	for i, kf := range result.Keyframes {
+		end := result.Duration
+		if i+1 < len(result.Keyframes) {
+			end = result.Keyframes[i+1].Timestamp
+		}
+		// Don't run a scene across a gap between processed ranges
+		for _, r := range result.Ranges {
+			if kf.Timestamp >= r.Start && kf.Timestamp < r.End && end > r.End {
+				end = r.End
+			}
+		}
+		if end < kf.Timestamp {
+			end = kf.Timestamp
+		}
+
+		scene := sceneData{
+			Keyframe: &keyframes[i],
+			StartStr: formatDuration(kf.Timestamp),
+			EndStr:   formatDuration(end),
+		}
+		last := i == len(result.Keyframes)-1
+		for _, seg := range result.Segments {
+			if seg.Start >= kf.Timestamp && (seg.Start < end || last) {
+				scene.Segments = append(scene.Segments, newSegmentData(seg, result))
+			}
+		}
+		scenes = append(scenes, scene)
+	}
+
+	return scenes
+}
+
+func newSegmentData(seg Segment, result Result) segmentData {
+	text := markLowConfidence(seg, result.LowConfidence)
+	if label := speakerLabel(result.Speakers, seg.Speaker); label != "" {
+		text = label + ": " + text
+	}
+	return segmentData{
+		StartStr: formatDuration(seg.Start),
+		Text:     text,
+	}
+}
+
+// speakerLabel returns the name of a segment's speaker, "Speaker N" if it
+// has none, or "" if the speaker is unknown
+func speakerLabel(names []string, speaker int) string {
+	switch {
+	case speaker <= 0:
+		return ""
+	case speaker <= len(names) && names[speaker-1] != "":
+		return names[speaker-1]
+	default:
+		return fmt.Sprintf("Speaker %d", speaker)
+	}
+}
+
+// markLowConfidence returns a segment's text with each run of words whisper
+// gave a lower probability than threshold wrapped in [? ?], so readers know
+// to double-check them
+func markLowConfidence(seg Segment, threshold float64) string {
+	if threshold <= 0 || len(seg.Words) == 0 {
+		return strings.TrimSpace(seg.Text)
+	}
+
+	var parts, doubtful []string
+	for _, w := range seg.Words {
+		if w.Probability < threshold {
+			doubtful = append(doubtful, w.Text)
+			continue
+		}
+		if len(doubtful) > 0 {
+			parts = append(parts, "[?"+strings.Join(doubtful, " ")+"?]")
+			doubtful = nil
+		}
+		parts = append(parts, w.Text)
+	}
+	if len(doubtful) > 0 {
+		parts = append(parts, "[?"+strings.Join(doubtful, " ")+"?]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// InputName returns the file name of an input for display: the base name of
+// a path, the last element of a URL's path, or "stdin" for "-"
+func InputName(input string) string {
+	if input == "-" {
+		return "stdin"
+	}
+	if u, err := url.Parse(input); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if name := path.Base(u.Path); name != "/" && name != "." {
+			return name
+		}
+		return u.Host
+	}
+	return filepath.Base(input)
+}
+
 // formatDuration formats a duration as M:SS or H:MM:SS
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
@@ -144,27 +460,3 @@ func formatDuration(d time.Duration) string {
 	}
 	return fmt.Sprintf("%d:%02d", m, s)
 }
-
-// EstimateTokens provides a rough estimate of tokens for the result
-func EstimateTokens(result Result) int {
-	// Rough estimates:
-	// - ~1.3 tokens per word in transcript
-	// - ~1000 tokens per image (varies by size/complexity, using conservative estimate)
-	// - ~100 tokens for metadata/formatting
-
-	var tokens int
-
-	// Metadata overhead
-	tokens += 100
-
-	// Transcript tokens
-	for _, seg := range result.Segments {
-		words := len(strings.Fields(seg.Text))
-		tokens += int(float64(words) * 1.3)
-	}
-
-	// Image tokens (conservative estimate for JPEG at quality 30, scaled 50%)
-	tokens += len(result.Keyframes) * 1000
-
-	return tokens
-}
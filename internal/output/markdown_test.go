@@ -108,6 +108,7 @@ func TestWriteMarkdown(t *testing.T) {
 		"Duration: 2:34",
 		"Original frames: 154",
 		"Keyframes extracted: 2",
+		"(metadata ~100, transcript ~",
 		"## Transcript",
 		"[0:00] Hello world",
 		"[0:05] This is a test",
@@ -123,6 +124,53 @@ func TestWriteMarkdown(t *testing.T) {
 	}
 }
 
+func TestWriteMarkdownRepeats(t *testing.T) {
+	tempDir := t.TempDir()
+	outputPath := filepath.Join(tempDir, "test_memorex.md")
+	framesDir := filepath.Join(tempDir, "test_memorex_frames")
+
+	// The title slide comes back twice; frame 15 is shown once
+	title := filepath.Join(framesDir, "frame_0001.jpg")
+	result := Result{
+		InputPath: "/path/to/video.mp4",
+		Duration:  4 * time.Minute,
+		Keyframes: []Keyframe{
+			{Index: 1, Timestamp: 0, Path: title},
+			{Index: 15, Timestamp: 15 * time.Second, Path: filepath.Join(framesDir, "frame_0015.jpg")},
+			{Index: 80, Timestamp: 80 * time.Second, Path: title, DuplicateOf: 1},
+			{Index: 185, Timestamp: 185 * time.Second, Path: title, DuplicateOf: 1},
+		},
+	}
+
+	if err := WriteMarkdown(outputPath, result); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	contentStr := string(content)
+
+	checks := []string{
+		"Keyframes extracted: 4 (2 repeats of earlier frames)",
+		"![Frame at 0:00](test_memorex_frames/frame_0001.jpg)\nOn screen at 0:00, 1:20, 3:05",
+		"### Frame 80 (1:20)\nSame as Frame 1 (on screen at 0:00, 1:20, 3:05)",
+		"### Frame 185 (3:05)\nSame as Frame 1",
+	}
+	for _, check := range checks {
+		if !strings.Contains(contentStr, check) {
+			t.Errorf("Output missing expected content: %q", check)
+		}
+	}
+
+	if n := strings.Count(contentStr, "!["); n != 2 {
+		t.Errorf("Expected 2 images for 2 distinct frames, got %d", n)
+	}
+	if strings.Contains(contentStr, "frame_0015.jpg)\nOn screen") {
+		t.Error("Expected no appearance list for a frame shown once")
+	}
+}
+
 func TestWriteMarkdownNoSegments(t *testing.T) {
 	tempDir := t.TempDir()
 	outputPath := filepath.Join(tempDir, "test.md")
@@ -206,3 +254,332 @@ func TestWriteMarkdownInvalidPath(t *testing.T) {
 		t.Error("Expected error for invalid output path")
 	}
 }
+
+func TestWriteMarkdownStoryboard(t *testing.T) {
+	tempDir := t.TempDir()
+	outputPath := filepath.Join(tempDir, "test_memorex.md")
+	framesDir := filepath.Join(tempDir, "test_memorex_frames")
+
+	result := Result{
+		InputPath:   "/path/to/video.mp4",
+		Duration:    time.Minute,
+		TotalFrames: 60,
+		Layout:      LayoutStoryboard,
+		Keyframes: []Keyframe{
+			{Index: 1, Timestamp: 0, Path: filepath.Join(framesDir, "frame_0001.jpg")},
+			{Index: 20, Timestamp: 20 * time.Second, Path: filepath.Join(framesDir, "frame_0020.jpg")},
+		},
+		Segments: []Segment{
+			{Start: 0, End: 5 * time.Second, Text: "Intro slide"},
+			{Start: 12 * time.Second, End: 19 * time.Second, Text: "Still on intro"},
+			{Start: 21 * time.Second, End: 30 * time.Second, Text: "Second slide"},
+		},
+	}
+
+	if err := WriteMarkdown(outputPath, result); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	contentStr := string(content)
+
+	if strings.Contains(contentStr, "## Transcript") || strings.Contains(contentStr, "## Keyframes") {
+		t.Error("Storyboard layout should not include separate transcript and keyframe sections")
+	}
+
+	// Each keyframe should be followed by the segments spoken while it was on screen
+	order := []string{
+		"## Storyboard",
+		"### Frame 1 (0:00–0:20)",
+		"![Frame at 0:00](test_memorex_frames/frame_0001.jpg)",
+		"[0:00] Intro slide",
+		"[0:12] Still on intro",
+		"### Frame 20 (0:20–1:00)",
+		"[0:21] Second slide",
+	}
+	pos := 0
+	for _, want := range order {
+		idx := strings.Index(contentStr[pos:], want)
+		if idx < 0 {
+			t.Fatalf("Expected %q after position %d in:\n%s", want, pos, contentStr)
+		}
+		pos += idx + len(want)
+	}
+}
+
+func TestBuildScenesLeadingSpeech(t *testing.T) {
+	result := Result{
+		Duration: 30 * time.Second,
+		Keyframes: []Keyframe{
+			{Index: 5, Timestamp: 5 * time.Second},
+		},
+		Segments: []Segment{
+			{Start: 0, Text: "Before any frame"},
+			{Start: 10 * time.Second, Text: "After the frame"},
+		},
+	}
+
+	scenes := buildScenes(result, []keyframeData{{Index: 5}})
+	if len(scenes) != 2 {
+		t.Fatalf("Expected 2 scenes, got %d", len(scenes))
+	}
+	if scenes[0].Keyframe != nil || len(scenes[0].Segments) != 1 {
+		t.Errorf("Expected leading scene without keyframe, got %+v", scenes[0])
+	}
+	if scenes[1].Keyframe == nil || len(scenes[1].Segments) != 1 {
+		t.Errorf("Expected keyframe scene with one segment, got %+v", scenes[1])
+	}
+}
+
+func TestBuildScenesRanges(t *testing.T) {
+	// Two processed ranges: a scene ends with its range, not at the next one
+	result := Result{
+		Duration: 90 * time.Minute,
+		Ranges: []TimeRange{
+			{Start: 12 * time.Minute, End: 18 * time.Minute},
+			{Start: 45 * time.Minute, End: 50 * time.Minute},
+		},
+		Keyframes: []Keyframe{
+			{Index: 1, Timestamp: 12 * time.Minute},
+			{Index: 300, Timestamp: 45 * time.Minute},
+		},
+	}
+
+	scenes := buildScenes(result, []keyframeData{{Index: 1}, {Index: 300}})
+	if len(scenes) != 2 {
+		t.Fatalf("Expected 2 scenes, got %d", len(scenes))
+	}
+	if scenes[0].EndStr != "18:00" || scenes[1].EndStr != "50:00" {
+		t.Errorf("Expected scenes to end at 18:00 and 50:00, got %s and %s", scenes[0].EndStr, scenes[1].EndStr)
+	}
+}
+
+func TestWriteMarkdownRanges(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.md")
+	result := Result{
+		InputPath: "/path/to/talk.mp4",
+		Duration:  90 * time.Minute,
+		Ranges:    []TimeRange{{Start: 12 * time.Minute, End: 18 * time.Minute}, {Start: 80 * time.Minute, End: 90 * time.Minute}},
+		Segments:  []Segment{{Start: 12*time.Minute + 5*time.Second, Text: "Where it gets interesting"}},
+	}
+
+	if err := WriteMarkdown(outputPath, result); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	for _, want := range []string{"- Processed: 12:00–18:00, 1:20:00–1:30:00", "[12:05] Where it gets interesting"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Output missing expected content: %s", want)
+		}
+	}
+}
+
+func TestWriteMarkdownMedia(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.md")
+	result := Result{
+		InputPath: "/path/to/sync.mov",
+		Duration:  2 * time.Minute,
+		Media: &Media{
+			Container:    "mov",
+			Title:        "Team sync",
+			CreationTime: time.Date(2024, 3, 1, 14, 5, 0, 0, time.UTC),
+			BitRate:      2_500_000,
+			Video:        &VideoStream{Codec: "hevc", Width: 1080, Height: 1920, FrameRate: 30000.0 / 1001, Rotation: 90},
+			Audio:        &AudioStream{Codec: "aac", Channels: 2, ChannelLayout: "stereo", SampleRate: 48000},
+			Chapters:     []Chapter{{End: time.Minute, Title: "Intro"}, {Start: time.Minute, End: 2 * time.Minute}},
+		},
+	}
+
+	if err := WriteMarkdown(outputPath, result); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	for _, want := range []string{
+		"- Duration: 2:00\n- Title: Team sync\n",
+		"- Recorded: 2024-03-01 14:05 UTC",
+		"- Container: mov, 2.5 Mb/s",
+		"- Video: hevc, 1080×1920, 29.97 fps, rotated 90°",
+		"- Audio: aac, stereo, 48 kHz",
+		"- Chapters: 2",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Output missing expected content: %s", want)
+		}
+	}
+}
+
+func TestMediaMetadataLinesAudioOnly(t *testing.T) {
+	m := &Media{Container: "mp3", BitRate: 128_000, Audio: &AudioStream{Codec: "mp3", Channels: 1, SampleRate: 44100}}
+	want := []string{"Container: mp3, 128 kb/s", "Video: none", "Audio: mp3, 1 channel, 44.1 kHz"}
+
+	got := m.metadataLines()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("metadataLines() = %q, want %q", got, want)
+	}
+	if lines := (*Media)(nil).metadataLines(); lines != nil {
+		t.Errorf("Expected no lines without media, got %q", lines)
+	}
+}
+
+func TestLanguageString(t *testing.T) {
+	tests := []struct {
+		result Result
+		want   string
+	}{
+		{Result{}, ""},
+		{Result{Language: "en"}, "en"},
+		{Result{Language: "es", LanguageDetected: true}, "es (detected)"},
+		{Result{Language: "de", Translated: true}, "de (translated to English)"},
+		{Result{Language: "fr", LanguageDetected: true, Translated: true}, "fr (detected, translated to English)"},
+	}
+	for _, tt := range tests {
+		if got := languageString(tt.result); got != tt.want {
+			t.Errorf("languageString(%+v) = %q, want %q", tt.result, got, tt.want)
+		}
+	}
+}
+
+func TestMarkLowConfidence(t *testing.T) {
+	seg := Segment{Text: "Deploy to Kubernetes tomorrow at noon.", Words: []Word{
+		{Text: "Deploy", Probability: 0.95},
+		{Text: "to", Probability: 0.9},
+		{Text: "Kubernetes", Probability: 0.3},
+		{Text: "tomorrow", Probability: 0.2},
+		{Text: "at", Probability: 0.8},
+		{Text: "noon.", Probability: 0.1},
+	}}
+
+	tests := []struct {
+		threshold float64
+		want      string
+	}{
+		{0, "Deploy to Kubernetes tomorrow at noon."},
+		{0.4, "Deploy to [?Kubernetes tomorrow?] at [?noon.?]"},
+		{0.25, "Deploy to Kubernetes [?tomorrow?] at [?noon.?]"},
+		{1, "[?Deploy to Kubernetes tomorrow at noon.?]"},
+	}
+	for _, tt := range tests {
+		if got := markLowConfidence(seg, tt.threshold); got != tt.want {
+			t.Errorf("markLowConfidence(%v) = %q, want %q", tt.threshold, got, tt.want)
+		}
+	}
+
+	// Without words the text is left alone
+	if got := markLowConfidence(Segment{Text: " Hello "}, 0.4); got != "Hello" {
+		t.Errorf("Expected untimed text unchanged, got %q", got)
+	}
+}
+
+func TestWriteMarkdownLowConfidence(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "call_memorex.md")
+	result := Result{
+		InputPath: "/path/to/call.mp4",
+		Duration:  10 * time.Second,
+		Segments: []Segment{{Start: 2 * time.Second, Text: "Ship it on Thursday", Words: []Word{
+			{Text: "Ship", Probability: 0.9},
+			{Text: "it", Probability: 0.9},
+			{Text: "on", Probability: 0.9},
+			{Text: "Thursday", Probability: 0.35},
+		}}},
+		LowConfidence: 0.4,
+	}
+	if err := WriteMarkdown(outputPath, result); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if !strings.Contains(string(content), "[0:02] Ship it on [?Thursday?]\n") {
+		t.Errorf("Expected the doubtful word to be marked, got:\n%s", content)
+	}
+}
+
+func TestWriteMarkdownSpeakers(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "interview_memorex.md")
+	result := Result{
+		InputPath: "/path/to/interview.mp4",
+		Duration:  30 * time.Second,
+		Segments: []Segment{
+			{Start: 0, Text: "Welcome to the show.", Speaker: 1},
+			{Start: 15 * time.Second, Text: "Thanks for having me.", Speaker: 2},
+			{Start: 20 * time.Second, Text: "Both talking.", Speaker: 0},
+			{Start: 25 * time.Second, Text: "A third voice.", Speaker: 3},
+		},
+		Speakers: []string{"Alice", "Bob"},
+	}
+	if err := WriteMarkdown(outputPath, result); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	for _, want := range []string{
+		"[0:00] Alice: Welcome to the show.\n",
+		"[0:15] Bob: Thanks for having me.\n",
+		"[0:20] Both talking.\n",
+		"[0:25] Speaker 3: A third voice.\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Output missing expected content: %q", want)
+		}
+	}
+}
+
+func TestSpeakerLabel(t *testing.T) {
+	tests := []struct {
+		names   []string
+		speaker int
+		want    string
+	}{
+		{nil, 0, ""},
+		{nil, 2, "Speaker 2"},
+		{[]string{"Alice", "Bob"}, 1, "Alice"},
+		{[]string{"Alice", ""}, 2, "Speaker 2"},
+		{[]string{"Alice"}, 2, "Speaker 2"},
+	}
+	for _, tt := range tests {
+		if got := speakerLabel(tt.names, tt.speaker); got != tt.want {
+			t.Errorf("speakerLabel(%q, %d) = %q, want %q", tt.names, tt.speaker, got, tt.want)
+		}
+	}
+}
+
+func TestInputName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"/path/to/video.mp4", "video.mp4"},
+		{"-", "stdin"},
+		{"https://example.com/media/talk.mp4?sig=abc", "talk.mp4"},
+		{"http://example.com/", "example.com"},
+	}
+	for _, tt := range tests {
+		if got := InputName(tt.input); got != tt.want {
+			t.Errorf("InputName(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	if l, err := ParseLayout("Storyboard"); err != nil || l != LayoutStoryboard {
+		t.Errorf("Expected storyboard, got %q (%v)", l, err)
+	}
+	if _, err := ParseLayout("grid"); err == nil {
+		t.Error("Expected error for unsupported layout")
+	}
+}
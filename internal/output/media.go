@@ -0,0 +1,115 @@
+package output
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media describes the input's container and streams
+type Media struct {
+	Container    string
+	Title        string
+	CreationTime time.Time // Zero if unknown
+	BitRate      int64     // Overall bits per second, 0 if unknown
+	Video        *VideoStream
+	Audio        *AudioStream
+	Chapters     []Chapter
+}
+
+// VideoStream describes the input's video
+type VideoStream struct {
+	Codec     string
+	Width     int // Display size, with rotation applied
+	Height    int
+	FrameRate float64
+	Rotation  int // Clockwise degrees applied for display
+}
+
+// AudioStream describes the input's audio
+type AudioStream struct {
+	Codec         string
+	Channels      int
+	ChannelLayout string
+	SampleRate    int // Hz
+}
+
+// Chapter is a chapter marker embedded in the input
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
+// metadataLines returns the markdown metadata entries describing the media
+func (m *Media) metadataLines() []string {
+	if m == nil {
+		return nil
+	}
+
+	var lines []string
+	if m.Title != "" {
+		lines = append(lines, "Title: "+m.Title)
+	}
+	if !m.CreationTime.IsZero() {
+		lines = append(lines, "Recorded: "+m.CreationTime.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+	if m.Container != "" {
+		container := "Container: " + m.Container
+		if m.BitRate > 0 {
+			container += ", " + formatBitRate(m.BitRate)
+		}
+		lines = append(lines, container)
+	}
+
+	if v := m.Video; v != nil {
+		parts := []string{v.Codec}
+		if v.Width > 0 && v.Height > 0 {
+			parts = append(parts, fmt.Sprintf("%d×%d", v.Width, v.Height))
+		}
+		if v.FrameRate > 0 {
+			// Two decimals tell 29.97 from 30 without printing 29.97002997
+			fps := math.Round(v.FrameRate*100) / 100
+			parts = append(parts, strconv.FormatFloat(fps, 'f', -1, 64)+" fps")
+		}
+		if v.Rotation != 0 {
+			parts = append(parts, fmt.Sprintf("rotated %d°", v.Rotation))
+		}
+		lines = append(lines, "Video: "+strings.Join(parts, ", "))
+	} else {
+		lines = append(lines, "Video: none")
+	}
+
+	if a := m.Audio; a != nil {
+		parts := []string{a.Codec}
+		switch {
+		case a.ChannelLayout != "":
+			parts = append(parts, a.ChannelLayout)
+		case a.Channels == 1:
+			parts = append(parts, "1 channel")
+		case a.Channels > 1:
+			parts = append(parts, fmt.Sprintf("%d channels", a.Channels))
+		}
+		if a.SampleRate > 0 {
+			parts = append(parts, strconv.FormatFloat(float64(a.SampleRate)/1000, 'f', -1, 64)+" kHz")
+		}
+		lines = append(lines, "Audio: "+strings.Join(parts, ", "))
+	} else {
+		lines = append(lines, "Audio: none")
+	}
+
+	if len(m.Chapters) > 0 {
+		lines = append(lines, fmt.Sprintf("Chapters: %d", len(m.Chapters)))
+	}
+	return lines
+}
+
+// formatBitRate formats bits per second as kb/s or Mb/s
+func formatBitRate(bps int64) string {
+	if bps >= 1_000_000 {
+		return strconv.FormatFloat(float64(bps)/1_000_000, 'f', 1, 64) + " Mb/s"
+	}
+	return strconv.FormatInt((bps+500)/1000, 10) + " kb/s"
+}
@@ -0,0 +1,242 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SubtitleFormat identifies a caption file format
+type SubtitleFormat string
+
+const (
+	// SubtitleSRT is the SubRip (.srt) caption format
+	SubtitleSRT SubtitleFormat = "srt"
+	// SubtitleVTT is the WebVTT (.vtt) caption format
+	SubtitleVTT SubtitleFormat = "vtt"
+)
+
+// SubtitleOptions controls how transcript segments are split into cues
+type SubtitleOptions struct {
+	MaxLineLength  int           // Maximum characters per caption line
+	MaxLines       int           // Maximum lines per cue
+	MaxCueDuration time.Duration // Longer segments are split into several cues
+}
+
+// DefaultSubtitleOptions returns broadcast-style caption defaults:
+// two lines of at most 42 characters, shown for no more than 7 seconds.
+func DefaultSubtitleOptions() SubtitleOptions {
+	return SubtitleOptions{
+		MaxLineLength:  42,
+		MaxLines:       2,
+		MaxCueDuration: 7 * time.Second,
+	}
+}
+
+// cue is a single caption with its wrapped lines
+type cue struct {
+	Start time.Duration
+	End   time.Duration
+	Lines []string
+}
+
+// ParseSubtitleFormat validates a subtitle format name
+func ParseSubtitleFormat(name string) (SubtitleFormat, error) {
+	switch f := SubtitleFormat(strings.ToLower(name)); f {
+	case SubtitleSRT, SubtitleVTT:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported subtitle format %q: must be srt or vtt", name)
+	}
+}
+
+// SubtitlePath returns the caption file path written alongside an output file
+func SubtitlePath(outputPath string, format SubtitleFormat) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "." + string(format)
+}
+
+// WriteSubtitles writes transcript segments as an SRT or WebVTT caption file
+func WriteSubtitles(outputPath string, segments []Segment, format SubtitleFormat, opts SubtitleOptions) error {
+	var content string
+	switch format {
+	case SubtitleSRT:
+		content = renderSRT(buildCues(segments, opts))
+	case SubtitleVTT:
+		content = renderVTT(buildCues(segments, opts))
+	default:
+		return fmt.Errorf("unsupported subtitle format %q", format)
+	}
+
+	if err := os.WriteFile(outputPath, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write subtitle file: %w", err)
+	}
+
+	return nil
+}
+
+func renderSRT(cues []cue) string {
+	var sb strings.Builder
+	for i, c := range cues {
+		fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n",
+			i+1,
+			formatCueTimestamp(c.Start, ','),
+			formatCueTimestamp(c.End, ','),
+			strings.Join(c.Lines, "\n"))
+	}
+	return sb.String()
+}
+
+func renderVTT(cues []cue) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		fmt.Fprintf(&sb, "%s --> %s\n%s\n\n",
+			formatCueTimestamp(c.Start, '.'),
+			formatCueTimestamp(c.End, '.'),
+			strings.Join(c.Lines, "\n"))
+	}
+	return sb.String()
+}
+
+// formatCueTimestamp formats a duration as HH:MM:SS<sep>mmm
+func formatCueTimestamp(d time.Duration, sep byte) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	h := ms / 3_600_000
+	m := ms / 60_000 % 60
+	s := ms / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", h, m, s, sep, ms%1000)
+}
+
+// buildCues splits segments into cues that fit the line and duration limits
+func buildCues(segments []Segment, opts SubtitleOptions) []cue {
+	var cues []cue
+	for _, seg := range segments {
+		cues = append(cues, splitSegment(seg, opts)...)
+	}
+	return cues
+}
+
+// splitSegment breaks a segment into one or more cues. Words are grouped so
+// each cue wraps to at most MaxLines lines, then split further if a cue would
+// stay on screen longer than MaxCueDuration. Cues change at the next word's
+// start when whisper timed the words; otherwise time is divided between cues
+// in proportion to their character count.
+func splitSegment(seg Segment, opts SubtitleOptions) []cue {
+	words := strings.Fields(seg.Text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	end := seg.End
+	if end <= seg.Start {
+		end = seg.Start + time.Second // Untimed segment; give it a minimal cue
+	}
+	duration := end - seg.Start
+
+	maxChars := opts.MaxLineLength * opts.MaxLines
+	totalChars := utf8.RuneCountInString(strings.Join(words, " "))
+
+	// Number of cues needed to keep each under the maximum duration
+	pieces := 1
+	if opts.MaxCueDuration > 0 {
+		pieces = int((duration + opts.MaxCueDuration - 1) / opts.MaxCueDuration)
+	}
+	if target := (totalChars + pieces - 1) / pieces; maxChars <= 0 || target < maxChars {
+		maxChars = target
+	}
+
+	groups := groupWords(words, maxChars, opts)
+
+	timed := len(seg.Words) == len(words)
+	cues := make([]cue, 0, len(groups))
+	start := seg.Start
+	consumed, wordCount := 0, 0
+	for i, group := range groups {
+		text := strings.Join(group, " ")
+		consumed += utf8.RuneCountInString(text)
+		wordCount += len(group)
+		cueEnd := seg.Start + time.Duration(float64(duration)*float64(consumed)/float64(totalChars))
+		if timed && i < len(groups)-1 {
+			cueEnd = max(seg.Words[wordCount].Start, start)
+		}
+		if i == len(groups)-1 || cueEnd > end {
+			cueEnd = end
+		}
+		cues = append(cues, cue{
+			Start: start,
+			End:   cueEnd,
+			Lines: wrapText(text, opts.MaxLineLength),
+		})
+		start = cueEnd
+	}
+
+	return cues
+}
+
+// groupWords greedily packs words into groups of at most maxChars characters
+// that also wrap to no more than MaxLines lines
+func groupWords(words []string, maxChars int, opts SubtitleOptions) [][]string {
+	var groups [][]string
+	var current []string
+	length := 0
+
+	for _, word := range words {
+		if len(current) > 0 {
+			candidate := append(append([]string{}, current...), word)
+			tooLong := length+1+utf8.RuneCountInString(word) > maxChars
+			tooManyLines := opts.MaxLines > 0 &&
+				len(wrapText(strings.Join(candidate, " "), opts.MaxLineLength)) > opts.MaxLines
+			if tooLong || tooManyLines {
+				groups = append(groups, current)
+				current = nil
+				length = 0
+			}
+		}
+		if len(current) > 0 {
+			length++
+		}
+		current = append(current, word)
+		length += utf8.RuneCountInString(word)
+	}
+
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// wrapText greedily wraps text into lines of at most width characters.
+// Words longer than width are kept whole on their own line.
+func wrapText(text string, width int) []string {
+	words := strings.Fields(text)
+	if width <= 0 {
+		return []string{strings.Join(words, " ")}
+	}
+
+	var lines []string
+	var line []string
+	lineWidth := 0
+	for _, word := range words {
+		wordWidth := utf8.RuneCountInString(word)
+		if len(line) > 0 && lineWidth+1+wordWidth > width {
+			lines = append(lines, strings.Join(line, " "))
+			line = nil
+			lineWidth = 0
+		}
+		if len(line) > 0 {
+			lineWidth++
+		}
+		line = append(line, word)
+		lineWidth += wordWidth
+	}
+	if len(line) > 0 {
+		lines = append(lines, strings.Join(line, " "))
+	}
+	return lines
+}
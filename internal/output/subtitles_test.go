@@ -0,0 +1,196 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatCueTimestamp(t *testing.T) {
+	tests := []struct {
+		input    time.Duration
+		sep      byte
+		expected string
+	}{
+		{0, ',', "00:00:00,000"},
+		{1500 * time.Millisecond, ',', "00:00:01,500"},
+		{time.Hour + 2*time.Minute + 3*time.Second + 45*time.Millisecond, '.', "01:02:03.045"},
+		{-time.Second, '.', "00:00:00.000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := formatCueTimestamp(tt.input, tt.sep); got != tt.expected {
+				t.Errorf("formatCueTimestamp(%v) = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText("the quick brown fox jumps over the lazy dog", 15)
+	expected := []string{"the quick brown", "fox jumps over", "the lazy dog"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("wrapText = %q, want %q", lines, expected)
+	}
+
+	// Long words stay whole
+	lines = wrapText("supercalifragilistic", 5)
+	if len(lines) != 1 || lines[0] != "supercalifragilistic" {
+		t.Errorf("Expected long word on a single line, got %q", lines)
+	}
+}
+
+func TestSplitSegmentShort(t *testing.T) {
+	seg := Segment{Start: time.Second, End: 3 * time.Second, Text: " Hello world "}
+	cues := splitSegment(seg, DefaultSubtitleOptions())
+
+	if len(cues) != 1 {
+		t.Fatalf("Expected 1 cue, got %d", len(cues))
+	}
+	if cues[0].Start != time.Second || cues[0].End != 3*time.Second {
+		t.Errorf("Expected cue timing to match segment, got %v-%v", cues[0].Start, cues[0].End)
+	}
+	if len(cues[0].Lines) != 1 || cues[0].Lines[0] != "Hello world" {
+		t.Errorf("Unexpected cue lines: %q", cues[0].Lines)
+	}
+}
+
+func TestSplitSegmentLongText(t *testing.T) {
+	opts := DefaultSubtitleOptions()
+	text := strings.Repeat("lorem ipsum dolor sit amet ", 10)
+	seg := Segment{Start: 0, End: 6 * time.Second, Text: text}
+
+	cues := splitSegment(seg, opts)
+	if len(cues) < 2 {
+		t.Fatalf("Expected long text to be split into several cues, got %d", len(cues))
+	}
+
+	for i, c := range cues {
+		if len(c.Lines) > opts.MaxLines {
+			t.Errorf("Cue %d has %d lines, max %d", i, len(c.Lines), opts.MaxLines)
+		}
+		for _, line := range c.Lines {
+			if len(line) > opts.MaxLineLength {
+				t.Errorf("Cue %d line too long (%d chars): %q", i, len(line), line)
+			}
+		}
+		if i > 0 && c.Start != cues[i-1].End {
+			t.Errorf("Cue %d does not start where cue %d ends", i, i-1)
+		}
+	}
+
+	if cues[0].Start != 0 || cues[len(cues)-1].End != 6*time.Second {
+		t.Errorf("Expected cues to span the segment, got %v-%v", cues[0].Start, cues[len(cues)-1].End)
+	}
+}
+
+func TestSplitSegmentMaxDuration(t *testing.T) {
+	opts := DefaultSubtitleOptions()
+	seg := Segment{Start: 0, End: 20 * time.Second, Text: "one two three four five six seven eight nine ten"}
+
+	cues := splitSegment(seg, opts)
+	if len(cues) < 3 {
+		t.Fatalf("Expected a 20s segment to be split into at least 3 cues, got %d", len(cues))
+	}
+	for i, c := range cues {
+		if c.End-c.Start > opts.MaxCueDuration+time.Second {
+			t.Errorf("Cue %d lasts %v, longer than %v", i, c.End-c.Start, opts.MaxCueDuration)
+		}
+	}
+}
+
+func TestSplitSegmentWordTimes(t *testing.T) {
+	opts := DefaultSubtitleOptions()
+	opts.MaxCueDuration = 0
+	opts.MaxLineLength = 8
+	opts.MaxLines = 1
+	// Most of the time is spent on the first two words
+	seg := Segment{Start: 0, End: 4 * time.Second, Text: "slowly said quick end", Words: []Word{
+		{Text: "slowly", Start: 0, End: 1500 * time.Millisecond},
+		{Text: "said", Start: 1500 * time.Millisecond, End: 3500 * time.Millisecond},
+		{Text: "quick", Start: 3500 * time.Millisecond, End: 3700 * time.Millisecond},
+		{Text: "end", Start: 3700 * time.Millisecond, End: 4 * time.Second},
+	}}
+
+	cues := splitSegment(seg, opts)
+	if len(cues) != 4 {
+		t.Fatalf("Expected a cue per word, got %+v", cues)
+	}
+	wantEnds := []time.Duration{1500 * time.Millisecond, 3500 * time.Millisecond, 3700 * time.Millisecond, 4 * time.Second}
+	for i, c := range cues {
+		if c.End != wantEnds[i] {
+			t.Errorf("Cue %d %q ends at %v, want %v", i, c.Lines, c.End, wantEnds[i])
+		}
+	}
+}
+
+func TestSplitSegmentEmpty(t *testing.T) {
+	if cues := splitSegment(Segment{Text: "   "}, DefaultSubtitleOptions()); len(cues) != 0 {
+		t.Errorf("Expected no cues for empty text, got %d", len(cues))
+	}
+}
+
+func TestWriteSubtitlesSRT(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.srt")
+	segments := []Segment{
+		{Start: 0, End: 2500 * time.Millisecond, Text: "Hello world"},
+		{Start: 2500 * time.Millisecond, End: 5 * time.Second, Text: "This is a test"},
+	}
+
+	if err := WriteSubtitles(outputPath, segments, SubtitleSRT, DefaultSubtitleOptions()); err != nil {
+		t.Fatalf("WriteSubtitles failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	expected := "1\n00:00:00,000 --> 00:00:02,500\nHello world\n\n" +
+		"2\n00:00:02,500 --> 00:00:05,000\nThis is a test\n\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected SRT output:\n%s", content)
+	}
+}
+
+func TestWriteSubtitlesVTT(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "test.vtt")
+	segments := []Segment{
+		{Start: 1200 * time.Millisecond, End: 3 * time.Second, Text: "Hello world"},
+	}
+
+	if err := WriteSubtitles(outputPath, segments, SubtitleVTT, DefaultSubtitleOptions()); err != nil {
+		t.Fatalf("WriteSubtitles failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	expected := "WEBVTT\n\n00:00:01.200 --> 00:00:03.000\nHello world\n\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected VTT output:\n%s", content)
+	}
+}
+
+func TestParseSubtitleFormat(t *testing.T) {
+	if f, err := ParseSubtitleFormat("SRT"); err != nil || f != SubtitleSRT {
+		t.Errorf("Expected srt, got %q (%v)", f, err)
+	}
+	if f, err := ParseSubtitleFormat("vtt"); err != nil || f != SubtitleVTT {
+		t.Errorf("Expected vtt, got %q (%v)", f, err)
+	}
+	if _, err := ParseSubtitleFormat("ass"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestSubtitlePath(t *testing.T) {
+	if got := SubtitlePath("/tmp/video_memorex.md", SubtitleVTT); got != "/tmp/video_memorex.vtt" {
+		t.Errorf("SubtitlePath = %s, want /tmp/video_memorex.vtt", got)
+	}
+}
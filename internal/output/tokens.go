@@ -0,0 +1,86 @@
+package output
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// metadataTokens covers the headings and metadata section
+	metadataTokens = 100
+	// chapterTokens covers a chapter's heading and table of contents entry
+	chapterTokens = 20
+	// tokensPerWord is the average token count per transcript word
+	tokensPerWord = 1.3
+	// unknownImageTokens is used when an image's size is unknown; it is a
+	// conservative estimate for a JPEG at quality 30, scaled 50%
+	unknownImageTokens = 1000
+	// pixelsPerToken is the vision model's image cost: width*height/750
+	pixelsPerToken = 750
+	// maxImageEdge is the longest edge the vision model accepts before it
+	// downscales the image, preserving aspect ratio
+	maxImageEdge = 1568
+	// maxImageTokens is the most a single image can cost; larger images are
+	// downscaled to roughly 1.15 megapixels
+	maxImageTokens = 1600
+)
+
+// TokenBreakdown is a per-section token estimate for a result
+type TokenBreakdown struct {
+	Metadata   int `json:"metadata"`
+	Transcript int `json:"transcript"`
+	Images     int `json:"images"`
+}
+
+// Total returns the estimate for the whole output
+func (b TokenBreakdown) Total() int {
+	return b.Metadata + b.Transcript + b.Images
+}
+
+// EstimateTokens provides a rough estimate of tokens for the result
+func EstimateTokens(result Result) int {
+	return EstimateTokenBreakdown(result).Total()
+}
+
+// EstimateTokenBreakdown estimates tokens for each section of the result:
+// ~100 for metadata and formatting plus ~20 per chapter, ~1.3 per transcript
+// word, and the vision-model cost of each keyframe image at its saved size.
+// Repeats of an earlier keyframe reuse its image and cost nothing.
+func EstimateTokenBreakdown(result Result) TokenBreakdown {
+	b := TokenBreakdown{Metadata: metadataTokens}
+	if result.Media != nil {
+		b.Metadata += len(result.Media.Chapters) * chapterTokens
+	}
+
+	for _, seg := range result.Segments {
+		words := len(strings.Fields(seg.Text)) + len(strings.Fields(speakerLabel(result.Speakers, seg.Speaker)))
+		b.Transcript += int(float64(words) * tokensPerWord)
+	}
+
+	for _, kf := range result.Keyframes {
+		if kf.DuplicateOf != 0 {
+			continue
+		}
+		b.Images += ImageTokens(kf.Width, kf.Height)
+	}
+
+	return b
+}
+
+// ImageTokens estimates the vision tokens for an image of the given size,
+// applying the same downscaling the model does: images whose long edge
+// exceeds 1568px are shrunk to fit, and the cost is capped at ~1600 tokens.
+func ImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		return unknownImageTokens
+	}
+
+	w, h := float64(width), float64(height)
+	if longEdge := math.Max(w, h); longEdge > maxImageEdge {
+		ratio := maxImageEdge / longEdge
+		w, h = math.Floor(w*ratio), math.Floor(h*ratio)
+	}
+
+	tokens := int(math.Ceil(w * h / pixelsPerToken))
+	return min(tokens, maxImageTokens)
+}
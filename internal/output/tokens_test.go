@@ -0,0 +1,72 @@
+package output
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImageTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		expected      int
+	}{
+		{"unknown size", 0, 0, 1000},
+		{"tiny", 750, 1, 1},
+		{"half-scale 720p", 640, 360, 308},
+		{"half-scale 1080p", 960, 540, 692},
+		// 1920x1080 is shrunk to 1568x882 first, then capped at 1600
+		{"full 1080p", 1920, 1080, 1600},
+		// 3000x200 is shrunk to 1568x104 by the long-edge rule
+		{"wide banner", 3000, 200, 218},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ImageTokens(tt.width, tt.height); got != tt.expected {
+				t.Errorf("ImageTokens(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEstimateTokenBreakdown(t *testing.T) {
+	result := Result{
+		Segments: []Segment{
+			{Text: "one two three four five six seven eight nine ten"},
+		},
+		Keyframes: []Keyframe{
+			{Index: 1, Width: 640, Height: 360},
+			{Index: 2, Width: 960, Height: 540},
+			{Index: 3},
+			// A repeat reuses frame 1's image
+			{Index: 4, Width: 640, Height: 360, DuplicateOf: 1},
+		},
+	}
+
+	b := EstimateTokenBreakdown(result)
+	if b.Metadata != 100 {
+		t.Errorf("Expected 100 metadata tokens, got %d", b.Metadata)
+	}
+	if b.Transcript != 13 {
+		t.Errorf("Expected 13 transcript tokens, got %d", b.Transcript)
+	}
+	if b.Images != 308+692+1000 {
+		t.Errorf("Expected %d image tokens, got %d", 308+692+1000, b.Images)
+	}
+	if b.Total() != EstimateTokens(result) {
+		t.Errorf("Total %d does not match EstimateTokens %d", b.Total(), EstimateTokens(result))
+	}
+
+	// Each chapter adds a heading and a contents entry
+	result.Media = &Media{Chapters: []Chapter{{Title: "Intro"}, {Start: time.Minute, Title: "Demo"}}}
+	if b := EstimateTokenBreakdown(result); b.Metadata != 140 {
+		t.Errorf("Expected 140 metadata tokens with 2 chapters, got %d", b.Metadata)
+	}
+
+	// Speaker labels are part of each line
+	result.Segments[0].Speaker = 1
+	if b := EstimateTokenBreakdown(result); b.Transcript != 15 {
+		t.Errorf("Expected 15 transcript tokens with a speaker label, got %d", b.Transcript)
+	}
+}
@@ -29,6 +29,7 @@ type Step struct {
 	percent  float64
 	complete bool
 	failed   bool
+	quiet    bool
 }
 
 // NewStep creates a new step with the given name and starts displaying it.
@@ -38,6 +39,12 @@ func NewStep(name string) *Step {
 	return s
 }
 
+// NewQuietStep creates a step that tracks progress without printing anything.
+// It is used for work running in the background, such as files in a batch.
+func NewQuietStep(name string) *Step {
+	return &Step{Name: name, quiet: true}
+}
+
 // Update updates the step's progress (0.0 to 1.0).
 func (s *Step) Update(percent float64) {
 	s.mu.Lock()
@@ -55,6 +62,9 @@ func (s *Step) Complete(message string) {
 	defer s.mu.Unlock()
 	s.complete = true
 	s.percent = 1.0
+	if s.quiet {
+		return
+	}
 	fmt.Fprintf(os.Stderr, "\r\033[K%s %s\n",
 		successStyle.Render("✓"),
 		textStyle.Render(message))
@@ -65,12 +75,31 @@ func (s *Step) Error(message string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.failed = true
+	if s.quiet {
+		return
+	}
 	fmt.Fprintf(os.Stderr, "\r\033[K%s %s\n",
 		errorStyle.Render("✗"),
 		textStyle.Render(message))
 }
 
+// Println prints a message on its own line above the step's progress bar.
+func (s *Step) Println(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s\n", message)
+	if !s.complete && !s.failed {
+		s.render()
+	}
+}
+
 func (s *Step) render() {
+	if s.quiet {
+		return
+	}
 	pct := s.percent * 100
 	if pct > 100 {
 		pct = 100
@@ -116,7 +145,12 @@ func PrintInfo(message string) {
 
 // PrintSuccess prints a success message.
 func PrintSuccess(message string) {
-	fmt.Fprintln(os.Stderr, successStyle.Render("✓ ")+textStyle.Render(message))
+	fmt.Fprintln(os.Stderr, SuccessLine(message))
+}
+
+// SuccessLine formats a success message without printing it.
+func SuccessLine(message string) string {
+	return successStyle.Render("✓ ") + textStyle.Render(message)
 }
 
 // PrintWarning prints a warning message.
@@ -127,5 +161,10 @@ func PrintWarning(message string) {
 
 // PrintError prints an error message.
 func PrintError(message string) {
-	fmt.Fprintln(os.Stderr, errorStyle.Render("✗ ")+textStyle.Render(message))
+	fmt.Fprintln(os.Stderr, ErrorLine(message))
+}
+
+// ErrorLine formats an error message without printing it.
+func ErrorLine(message string) string {
+	return errorStyle.Render("✗ ") + textStyle.Render(message)
 }
@@ -0,0 +1,49 @@
+package video
+
+import "math/bits"
+
+// DefaultDedupeDistance is the most perceptual hash bits, out of 64, two
+// keyframes may differ by and still count as the same image
+const DefaultDedupeDistance = 6
+
+// DedupeKeyframes marks keyframes that repeat an earlier one anywhere in the
+// video, such as a slide shown again later in a talk. Each repeat gets
+// DuplicateOf set to the Index of the first keyframe whose hash is within
+// maxDistance bits of its own. The frames must carry the Hash recorded when
+// they were scored; keyframes whose frame is missing are never marked.
+func DedupeKeyframes(frames []Frame, keyframes []Keyframe, maxDistance int) []Keyframe {
+	hashes := make(map[int]uint64, len(frames))
+	for _, f := range frames {
+		hashes[f.Index] = f.Hash
+	}
+
+	deduped := make([]Keyframe, len(keyframes))
+	copy(deduped, keyframes)
+
+	// Only originals are candidates, so a chain of near matches can't drift
+	type original struct {
+		index int
+		hash  uint64
+	}
+	var originals []original
+
+	for i := range deduped {
+		deduped[i].DuplicateOf = 0
+		hash, ok := hashes[deduped[i].Index]
+		if !ok {
+			continue
+		}
+
+		for _, o := range originals {
+			if bits.OnesCount64(hash^o.hash) <= maxDistance {
+				deduped[i].DuplicateOf = o.index
+				break
+			}
+		}
+		if deduped[i].DuplicateOf == 0 {
+			originals = append(originals, original{index: deduped[i].Index, hash: hash})
+		}
+	}
+
+	return deduped
+}
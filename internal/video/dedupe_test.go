@@ -0,0 +1,48 @@
+package video
+
+import "testing"
+
+func TestDedupeKeyframes(t *testing.T) {
+	// Slides A, B, A (slightly recompressed), C, B
+	frames := []Frame{
+		{Index: 1, Hash: 0xF0F0F0F0F0F0F0F0},
+		{Index: 2, Hash: 0x0F0F0F0F0F0F0F0F},
+		{Index: 3, Hash: 0xF0F0F0F0F0F0F0F1},
+		{Index: 4, Hash: 0xFFFF0000FFFF0000},
+		{Index: 5, Hash: 0x0F0F0F0F0F0F0F0F},
+	}
+	keyframes := []Keyframe{{Index: 1}, {Index: 2}, {Index: 3}, {Index: 4}, {Index: 5}}
+
+	deduped := DedupeKeyframes(frames, keyframes, DefaultDedupeDistance)
+	want := []int{0, 0, 1, 0, 2}
+	for i, kf := range deduped {
+		if kf.DuplicateOf != want[i] {
+			t.Errorf("Keyframe %d: expected DuplicateOf %d, got %d", kf.Index, want[i], kf.DuplicateOf)
+		}
+	}
+	if keyframes[2].DuplicateOf != 0 {
+		t.Error("DedupeKeyframes modified its input")
+	}
+
+	// With no tolerance, the recompressed slide counts as new
+	strict := DedupeKeyframes(frames, keyframes, 0)
+	if strict[2].DuplicateOf != 0 || strict[4].DuplicateOf != 2 {
+		t.Errorf("Unexpected strict dedupe: %+v", strict)
+	}
+}
+
+func TestDedupeKeyframesRealFrames(t *testing.T) {
+	// A slide returns after a different one, with a small brightness shift
+	a := makeThumbnail(64, 64, waves)
+	b := makeThumbnail(64, 64, checkerboard)
+	again := makeThumbnail(64, 64, func(x, y int) (uint8, uint8, uint8) {
+		r, g, bl := waves(x, y)
+		return r + 10, g + 5, bl - 10
+	})
+
+	frames := []Frame{{Index: 1, Hash: pHash(a)}, {Index: 2, Hash: pHash(b)}, {Index: 3, Hash: pHash(again)}}
+	deduped := DedupeKeyframes(frames, []Keyframe{{Index: 1}, {Index: 2}, {Index: 3}}, DefaultDedupeDistance)
+	if deduped[1].DuplicateOf != 0 || deduped[2].DuplicateOf != 1 {
+		t.Errorf("Expected only frame 3 to repeat frame 1, got %+v", deduped)
+	}
+}
@@ -5,136 +5,164 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
-	"os/exec"
-	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// Frame represents an extracted video frame
+// Frame represents a sampled video frame
 type Frame struct {
-	Path      string
 	Index     int
 	Timestamp time.Duration
+	// Sharpness is the variance of the Laplacian of the comparison thumbnail
+	// (higher is sharper), set when frames are scored
+	Sharpness float64
+	// PrevSimilarity is the similarity with the previous frame, set when
+	// frames are scored. The first frame reports 0.
+	PrevSimilarity float64
+	// Hash is the perceptual hash of the comparison thumbnail, set when
+	// frames are scored
+	Hash uint64
 }
 
 // Keyframe represents a frame that differs significantly from its predecessor
 type Keyframe struct {
-	Path      string
-	Index     int
+	// Path and Index identify the frame whose image is saved
+	Path  string
+	Index int
+	// Timestamp is when the change was detected
 	Timestamp time.Duration
+	// Similarity is the correlation with the frame it was compared against
+	// (lower means a bigger change). The first frame has no predecessor and
+	// reports 0.
+	Similarity float64
+	// ImageTimestamp is the timestamp of the saved frame. It is later than
+	// Timestamp when RefineKeyframes picked a frame after the change.
+	ImageTimestamp time.Duration
+	// DuplicateOf is the Index of an earlier keyframe that looks the same,
+	// set by DedupeKeyframes. Repeats have no image of their own.
+	DuplicateOf int
 }
 
 // ProgressFunc is called with progress updates (0.0 to 1.0)
 type ProgressFunc func(percent float64)
 
-// GetDuration returns the duration of a video file using ffprobe
-func GetDuration(inputPath string) (time.Duration, error) {
-	cmd := exec.Command("ffprobe",
-		"-v", "error",
-		"-show_entries", "format=duration",
-		"-of", "default=noprint_wrappers=1:nokey=1",
-		inputPath,
-	)
-
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, fmt.Errorf("ffprobe failed: %w", err)
-	}
+// Sampler selects which frames are extracted from the video
+type Sampler string
 
-	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse duration: %w", err)
-	}
+const (
+	// SamplerFPS extracts frames at a fixed rate
+	SamplerFPS Sampler = "fps"
+	// SamplerScene extracts only frames whose ffmpeg scene-change score
+	// exceeds a threshold, plus the first frame
+	SamplerScene Sampler = "scene"
+)
 
-	return time.Duration(seconds * float64(time.Second)), nil
+// ExtractOptions controls frame extraction
+type ExtractOptions struct {
+	Sampler        Sampler
+	FPS            float64 // Frames per second for SamplerFPS; fractions allowed
+	SceneThreshold float64 // Minimum scene score (0-1) for SamplerScene
+	// Ranges limits sampling to these parts of the input, which must be
+	// sorted and not overlap (see MergeRanges). Nil samples all of it.
+	Ranges []TimeRange
 }
 
-// ExtractFrames extracts frames from a video file at 1 fps
-func ExtractFrames(inputPath string, duration time.Duration, onProgress ProgressFunc) ([]Frame, error) {
-	// Create temp directory for frames
-	tempDir, err := os.MkdirTemp("", "memorex-frames-*")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+// ParseSampler validates a sampler name
+func ParseSampler(name string) (Sampler, error) {
+	switch s := Sampler(strings.ToLower(name)); s {
+	case SamplerFPS, SamplerScene:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unsupported sampler %q: must be fps or scene", name)
 	}
+}
 
-	// Extract frames at 1 fps using FFmpeg
-	outputPattern := filepath.Join(tempDir, "%04d.png")
-	cmd := exec.Command("ffmpeg",
-		"-i", inputPath,
-		"-vf", "fps=1",
-		"-q:v", "2",
-		"-loglevel", "error",
-		"-progress", "pipe:1", // Output progress to stdout
-		"-nostats",
-		outputPattern,
-	)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		_ = os.RemoveAll(tempDir)
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+// samplerFilter returns the ffmpeg filter that picks the sampled frames
+func (o ExtractOptions) samplerFilter() (string, error) {
+	switch o.Sampler {
+	case SamplerFPS, "":
+		if o.FPS <= 0 {
+			return "", fmt.Errorf("fps must be positive, got %g", o.FPS)
+		}
+		return "fps=" + strconv.FormatFloat(o.FPS, 'f', -1, 64), nil
+	case SamplerScene:
+		if o.SceneThreshold <= 0 || o.SceneThreshold >= 1 {
+			return "", fmt.Errorf("scene threshold must be between 0 and 1, got %g", o.SceneThreshold)
+		}
+		threshold := strconv.FormatFloat(o.SceneThreshold, 'f', -1, 64)
+		return fmt.Sprintf("select='eq(n\\,0)+gt(scene\\,%s)'", threshold), nil
+	default:
+		return "", fmt.Errorf("unsupported sampler %q", o.Sampler)
 	}
+}
 
-	if err := cmd.Start(); err != nil {
-		_ = os.RemoveAll(tempDir)
-		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+// assignTimestamps sets each frame's timestamp from the showinfo PTS of the
+// matching output frame, relative to the first one, plus start. If ffmpeg
+// didn't report a timestamp for every frame, the fixed-rate timestamp
+// position/fps is used; scene-change frames are irregularly spaced, so
+// their times can't be worked out and that is an error.
+func assignTimestamps(frames []Frame, pts []time.Duration, opts ExtractOptions, start time.Duration) error {
+	if len(pts) >= len(frames) {
+		for i := range frames {
+			frames[i].Timestamp = start + pts[i] - pts[0]
+		}
+		return nil
 	}
-
-	// Parse progress output
-	if onProgress != nil && duration > 0 {
-		go parseFFmpegProgress(stdout, duration, onProgress)
+	if opts.Sampler == SamplerScene {
+		return fmt.Errorf("ffmpeg reported timestamps for %d of %d scene-change frames", len(pts), len(frames))
 	}
 
-	if err := cmd.Wait(); err != nil {
-		_ = os.RemoveAll(tempDir)
-		return nil, fmt.Errorf("ffmpeg extraction failed: %w", err)
+	fps := opts.FPS
+	if fps <= 0 {
+		fps = 1
 	}
-
-	// Read extracted frames
-	entries, err := os.ReadDir(tempDir)
-	if err != nil {
-		_ = os.RemoveAll(tempDir)
-		return nil, fmt.Errorf("failed to read temp directory: %w", err)
+	for i := range frames {
+		frames[i].Timestamp = start + time.Duration(float64(i)/fps*float64(time.Second))
 	}
+	return nil
+}
+
+// showinfoLog holds what was parsed from ffmpeg's stderr
+type showinfoLog struct {
+	pts       []time.Duration // Presentation timestamp of each output frame
+	lastError string          // Last line that wasn't showinfo output
+}
 
-	// Parse frame files and create Frame objects
-	framePattern := regexp.MustCompile(`^(\d+)\.png$`)
-	frames := make([]Frame, 0, len(entries))
+var showinfoPattern = regexp.MustCompile(`\[Parsed_showinfo_\d+ @ [^\]]+\] n:\s*(\d+) .*?pts_time:\s*(-?[\d.]+)`)
 
-	for _, entry := range entries {
-		if entry.IsDir() {
+// parseShowinfo reads ffmpeg stderr and extracts the pts_time of each frame
+// logged by the showinfo filter, in output order. If ffmpeg was run with
+// -progress pipe:2, progress updates are passed to onProgress.
+func parseShowinfo(stderr io.Reader, totalDuration time.Duration, onProgress ProgressFunc) showinfoLog {
+	var log showinfoLog
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if usStr, ok := strings.CutPrefix(line, "out_time_us="); ok {
+			if us, err := strconv.ParseInt(usStr, 10, 64); err == nil && onProgress != nil && totalDuration > 0 {
+				onProgress(min(float64(time.Duration(us)*time.Microsecond)/float64(totalDuration), 1.0))
+			}
 			continue
 		}
 
-		matches := framePattern.FindStringSubmatch(entry.Name())
+		matches := showinfoPattern.FindStringSubmatch(line)
 		if matches == nil {
+			if strings.Contains(strings.ToLower(line), "error") {
+				log.lastError = strings.TrimSpace(line)
+			}
 			continue
 		}
 
-		index, _ := strconv.Atoi(matches[1])
-		frames = append(frames, Frame{
-			Path:      filepath.Join(tempDir, entry.Name()),
-			Index:     index,
-			Timestamp: time.Duration(index-1) * time.Second, // 1 fps means 1 frame per second
-		})
-	}
-
-	// Sort frames by index
-	sort.Slice(frames, func(i, j int) bool {
-		return frames[i].Index < frames[j].Index
-	})
-
-	if len(frames) == 0 {
-		_ = os.RemoveAll(tempDir)
-		return nil, fmt.Errorf("no frames extracted from video")
+		seconds, err := strconv.ParseFloat(matches[2], 64)
+		if err != nil {
+			continue
+		}
+		log.pts = append(log.pts, time.Duration(seconds*float64(time.Second)))
 	}
-
-	return frames, nil
+	return log
 }
 
 // parseFFmpegProgress reads ffmpeg progress output and calls the callback
@@ -157,12 +185,3 @@ func parseFFmpegProgress(stdout io.Reader, totalDuration time.Duration, onProgre
 		}
 	}
 }
-
-// CleanupFrames removes the temporary frame directory
-func CleanupFrames(frames []Frame) {
-	if len(frames) == 0 {
-		return
-	}
-	tempDir := filepath.Dir(frames[0].Path)
-	_ = os.RemoveAll(tempDir)
-}
@@ -3,129 +3,129 @@ package video
 import (
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestGetDuration(t *testing.T) {
-	// Skip if ffprobe is not available
-	if _, err := exec.LookPath("ffprobe"); err != nil {
-		t.Skip("ffprobe not found, skipping test")
-	}
-
-	// Create a test video file
-	testVideo := createTestVideo(t)
-	defer func() { _ = os.Remove(testVideo) }()
-
-	duration, err := GetDuration(testVideo)
-	if err != nil {
-		t.Fatalf("GetDuration failed: %v", err)
+func TestParseSampler(t *testing.T) {
+	for _, name := range []string{"fps", "scene", "Scene"} {
+		if _, err := ParseSampler(name); err != nil {
+			t.Errorf("ParseSampler(%q) failed: %v", name, err)
+		}
 	}
-
-	// Test video should be approximately 1 second
-	if duration < 500*time.Millisecond || duration > 2*time.Second {
-		t.Errorf("Expected duration around 1s, got %v", duration)
+	if _, err := ParseSampler("keyframes"); err == nil {
+		t.Error("Expected error for unknown sampler")
 	}
 }
 
-func TestGetDurationNonexistent(t *testing.T) {
-	_, err := GetDuration("/nonexistent/video.mp4")
-	if err == nil {
-		t.Error("Expected error for nonexistent file")
+func TestExtractOptionsSamplerFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ExtractOptions
+		want    string
+		wantErr bool
+	}{
+		{"one per second", ExtractOptions{Sampler: SamplerFPS, FPS: 1}, "fps=1", false},
+		{"fractional fps", ExtractOptions{Sampler: SamplerFPS, FPS: 0.25}, "fps=0.25", false},
+		{"scene", ExtractOptions{Sampler: SamplerScene, SceneThreshold: 0.4}, "select='eq(n\\,0)+gt(scene\\,0.4)'", false},
+		{"zero fps", ExtractOptions{Sampler: SamplerFPS}, "", true},
+		{"scene threshold out of range", ExtractOptions{Sampler: SamplerScene, SceneThreshold: 1}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.samplerFilter()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("samplerFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("samplerFilter() = %q, want %q", got, tt.want)
+			}
+		})
 	}
 }
 
-func TestExtractFrames(t *testing.T) {
-	// Skip if ffmpeg is not available
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		t.Skip("ffmpeg not found, skipping test")
+func TestParseShowinfo(t *testing.T) {
+	stderr := strings.Join([]string{
+		"Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'talk.mp4':",
+		"[Parsed_showinfo_1 @ 0x7f8] n:   0 pts:      0 pts_time:0       duration:1",
+		"[Parsed_showinfo_1 @ 0x7f8] n:   1 pts:  48048 pts_time:3.75375 duration:1",
+		"[Parsed_showinfo_1 @ 0x7f8] color_range:unknown color_space:unknown",
+		"[Parsed_showinfo_1 @ 0x7f8] n:   2 pts: 160160 pts_time:12.5125 duration:1",
+		"Error while decoding stream #0:0: Invalid data found when processing input",
+	}, "\n")
+
+	log := parseShowinfo(strings.NewReader(stderr), 0, nil)
+
+	want := []time.Duration{0, 3753750 * time.Microsecond, 12512500 * time.Microsecond}
+	if len(log.pts) != len(want) {
+		t.Fatalf("Expected %d timestamps, got %v", len(want), log.pts)
+	}
+	for i := range want {
+		if log.pts[i] != want[i] {
+			t.Errorf("pts[%d] = %v, want %v", i, log.pts[i], want[i])
+		}
 	}
-
-	// Create a test video file
-	testVideo := createTestVideo(t)
-	defer func() { _ = os.Remove(testVideo) }()
-
-	frames, err := ExtractFrames(testVideo, time.Second, nil)
-	if err != nil {
-		t.Fatalf("ExtractFrames failed: %v", err)
+	if !strings.HasPrefix(log.lastError, "Error while decoding") {
+		t.Errorf("Expected last error line, got %q", log.lastError)
 	}
-	defer CleanupFrames(frames)
+}
 
-	if len(frames) == 0 {
-		t.Error("Expected at least one frame")
+func TestAssignTimestamps(t *testing.T) {
+	// PTS are relative to the first frame, so a nonzero start time is removed
+	frames := []Frame{{Index: 1}, {Index: 2}, {Index: 3}}
+	pts := []time.Duration{1400 * time.Millisecond, 2 * time.Second, 9 * time.Second}
+	if err := assignTimestamps(frames, pts, ExtractOptions{Sampler: SamplerScene}, 0); err != nil {
+		t.Fatalf("assignTimestamps failed: %v", err)
 	}
 
-	// Verify frames have valid paths
-	for _, frame := range frames {
-		if _, err := os.Stat(frame.Path); os.IsNotExist(err) {
-			t.Errorf("Frame file does not exist: %s", frame.Path)
+	want := []time.Duration{0, 600 * time.Millisecond, 7600 * time.Millisecond}
+	for i := range frames {
+		if frames[i].Timestamp != want[i] {
+			t.Errorf("frame %d timestamp = %v, want %v", i, frames[i].Timestamp, want[i])
 		}
 	}
 }
 
-func TestExtractFramesWithProgress(t *testing.T) {
-	// Skip if ffmpeg is not available
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		t.Skip("ffmpeg not found, skipping test")
+func TestAssignTimestampsFallback(t *testing.T) {
+	// Without showinfo output, timestamps follow the fixed sampling rate
+	frames := []Frame{{Index: 1}, {Index: 2}, {Index: 3}}
+	if err := assignTimestamps(frames, nil, ExtractOptions{Sampler: SamplerFPS, FPS: 2}, 0); err != nil {
+		t.Fatalf("assignTimestamps failed: %v", err)
 	}
 
-	// Create a test video file
-	testVideo := createTestVideo(t)
-	defer func() { _ = os.Remove(testVideo) }()
-
-	var progressCalled bool
-	frames, err := ExtractFrames(testVideo, time.Second, func(pct float64) {
-		progressCalled = true
-		if pct < 0 || pct > 1 {
-			t.Errorf("Progress out of range: %f", pct)
+	want := []time.Duration{0, 500 * time.Millisecond, time.Second}
+	for i := range frames {
+		if frames[i].Timestamp != want[i] {
+			t.Errorf("frame %d timestamp = %v, want %v", i, frames[i].Timestamp, want[i])
 		}
-	})
-	if err != nil {
-		t.Fatalf("ExtractFrames failed: %v", err)
-	}
-	defer CleanupFrames(frames)
-
-	if !progressCalled {
-		t.Log("Progress callback was not called (may be due to short video)")
 	}
 }
 
-func TestExtractFramesNonexistent(t *testing.T) {
-	_, err := ExtractFrames("/nonexistent/video.mp4", 0, nil)
-	if err == nil {
-		t.Error("Expected error for nonexistent file")
+func TestAssignTimestampsSceneMissing(t *testing.T) {
+	// Scene-change frames have no fixed rate to fall back on
+	frames := []Frame{{Index: 1}, {Index: 2}, {Index: 3}}
+	pts := []time.Duration{0, 4 * time.Second}
+	err := assignTimestamps(frames, pts, ExtractOptions{Sampler: SamplerScene}, 0)
+	if err == nil || !strings.Contains(err.Error(), "2 of 3 scene-change frames") {
+		t.Errorf("Expected an error for missing scene timestamps, got %v", err)
 	}
 }
 
-func TestCleanupFrames(t *testing.T) {
-	// Create temp directory with a fake frame
-	tempDir, err := os.MkdirTemp("", "memorex-test-*")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-
-	framePath := filepath.Join(tempDir, "0001.png")
-	if err := os.WriteFile(framePath, []byte("test"), 0o600); err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
+func TestAssignTimestampsRangeStart(t *testing.T) {
+	// Frames sampled from a range keep their time in the original input
+	frames := []Frame{{Index: 4}, {Index: 5}}
+	pts := []time.Duration{0, 500 * time.Millisecond}
+	if err := assignTimestamps(frames, pts, ExtractOptions{Sampler: SamplerFPS, FPS: 2}, 12*time.Minute); err != nil {
+		t.Fatalf("assignTimestamps failed: %v", err)
 	}
 
-	frames := []Frame{{Path: framePath}}
-	CleanupFrames(frames)
-
-	// Verify directory was removed
-	if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
-		t.Error("Expected temp directory to be removed")
-		_ = os.RemoveAll(tempDir)
+	if frames[0].Timestamp != 12*time.Minute || frames[1].Timestamp != 12*time.Minute+500*time.Millisecond {
+		t.Errorf("Expected timestamps from 12m, got %v and %v", frames[0].Timestamp, frames[1].Timestamp)
 	}
 }
 
-func TestCleanupFramesEmpty(t *testing.T) {
-	// Should not panic with empty slice
-	CleanupFrames([]Frame{})
-	CleanupFrames(nil)
-}
-
 // createTestVideo creates a minimal test video using ffmpeg
 func createTestVideo(t *testing.T) string {
 	t.Helper()
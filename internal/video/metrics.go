@@ -0,0 +1,341 @@
+package video
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// Thumbnail is a frame downscaled for comparison
+type Thumbnail struct {
+	Width  int
+	Height int
+	// Gray holds luminance from 0 to 1, row by row
+	Gray []float64
+	// RGB holds 8-bit red, green and blue for each pixel, row by row
+	RGB []uint8
+	// Mask marks ignored pixels, which metrics leave out. Nil means every
+	// pixel counts. Thumbnails compared with each other share a mask.
+	Mask []bool
+}
+
+// ignored reports whether pixel i is masked out
+func (t *Thumbnail) ignored(i int) bool {
+	return t.Mask != nil && t.Mask[i]
+}
+
+// newThumbnail builds a thumbnail from packed 8-bit RGB pixels
+func newThumbnail(width, height int, rgb []uint8) *Thumbnail {
+	gray := make([]float64, width*height)
+	for i := range gray {
+		r, g, b := float64(rgb[3*i]), float64(rgb[3*i+1]), float64(rgb[3*i+2])
+		// Standard grayscale conversion
+		gray[i] = (0.299*r + 0.587*g + 0.114*b) / 255.0
+	}
+	return &Thumbnail{Width: width, Height: height, Gray: gray, RGB: rgb}
+}
+
+// Similarity compares two thumbnails of the same size. Scores are at most 1,
+// which means identical; lower means a bigger change.
+type Similarity interface {
+	// Name is the metric's command-line name
+	Name() string
+	Compare(a, b *Thumbnail) float64
+}
+
+// Metric names accepted by ParseMetric
+const (
+	MetricNCC       = "ncc"
+	MetricSSIM      = "ssim"
+	MetricDHash     = "dhash"
+	MetricPHash     = "phash"
+	MetricHistogram = "histogram"
+)
+
+// ParseMetric returns the similarity metric with the given name
+func ParseMetric(name string) (Similarity, error) {
+	switch strings.ToLower(name) {
+	case MetricNCC:
+		return NCC{}, nil
+	case MetricSSIM:
+		return SSIM{}, nil
+	case MetricDHash:
+		return DHash{}, nil
+	case MetricPHash:
+		return PHash{}, nil
+	case MetricHistogram:
+		return Histogram{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported metric %q: must be ncc, ssim, dhash, phash or histogram", name)
+	}
+}
+
+// NCC is normalized cross-correlation of luminance. It ignores uniform
+// brightness and contrast changes, and scores any two flat images as 1.
+type NCC struct{}
+
+// Name implements Similarity
+func (NCC) Name() string { return MetricNCC }
+
+// Compare implements Similarity
+func (NCC) Compare(a, b *Thumbnail) float64 {
+	return maskedCrossCorrelation(a.Gray, b.Gray, a.Mask)
+}
+
+// SSIM is the mean structural similarity of luminance over 8x8 windows. It
+// reacts to brightness, contrast and structure, so fades and changes between
+// flat slides register. Windows touching masked pixels are skipped.
+type SSIM struct{}
+
+// Name implements Similarity
+func (SSIM) Name() string { return MetricSSIM }
+
+// Compare implements Similarity
+func (SSIM) Compare(a, b *Thumbnail) float64 {
+	const (
+		window = 8
+		c1     = 0.01 * 0.01 // (k1*L)^2 with L = 1
+		c2     = 0.03 * 0.03 // (k2*L)^2
+	)
+
+	if a.Width != b.Width || a.Height != b.Height || len(a.Gray) == 0 {
+		return 0
+	}
+
+	var total float64
+	var windows int
+	for y0 := 0; y0+window <= a.Height; y0 += window {
+		for x0 := 0; x0+window <= a.Width; x0 += window {
+			if a.Mask != nil && windowMasked(a, x0, y0, window) {
+				continue
+			}
+
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for y := y0; y < y0+window; y++ {
+				for x := x0; x < x0+window; x++ {
+					va, vb := a.Gray[y*a.Width+x], b.Gray[y*b.Width+x]
+					sumA += va
+					sumB += vb
+					sumAA += va * va
+					sumBB += vb * vb
+					sumAB += va * vb
+				}
+			}
+
+			n := float64(window * window)
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			cov := sumAB/n - meanA*meanB
+
+			total += ((2*meanA*meanB + c1) * (2*cov + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+
+	if windows == 0 {
+		// Nothing left to compare once masked
+		return 1
+	}
+	return total / float64(windows)
+}
+
+// windowMasked reports whether any pixel of the size x size window at x0,y0
+// is masked
+func windowMasked(t *Thumbnail, x0, y0, size int) bool {
+	for y := y0; y < y0+size; y++ {
+		for x := x0; x < x0+size; x++ {
+			if t.Mask[y*t.Width+x] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DHash compares difference hashes: 64 bits recording whether each cell of a
+// 9x8 luminance grid is brighter than its right neighbor. The score is the
+// fraction of matching bits.
+type DHash struct{}
+
+// Name implements Similarity
+func (DHash) Name() string { return MetricDHash }
+
+// Compare implements Similarity
+func (DHash) Compare(a, b *Thumbnail) float64 {
+	return hashSimilarity(dHash(a), dHash(b))
+}
+
+func dHash(t *Thumbnail) uint64 {
+	grid := shrinkGray(t, 9, 8)
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			hash <<= 1
+			if grid[y*9+x] > grid[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// PHash compares perceptual hashes: 64 bits recording whether each of the
+// lowest-frequency DCT coefficients of a 32x32 luminance grid is above their
+// median. The score is the fraction of matching bits.
+type PHash struct{}
+
+// Name implements Similarity
+func (PHash) Name() string { return MetricPHash }
+
+// Compare implements Similarity
+func (PHash) Compare(a, b *Thumbnail) float64 {
+	return hashSimilarity(pHash(a), pHash(b))
+}
+
+const (
+	phashSize = 32
+	phashBits = 8
+)
+
+// phashCos[u][x] is the DCT-II basis cos((2x+1)uπ/2N)
+var phashCos = func() [phashBits][phashSize]float64 {
+	var table [phashBits][phashSize]float64
+	for u := range phashBits {
+		for x := range phashSize {
+			table[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+	return table
+}()
+
+func pHash(t *Thumbnail) uint64 {
+	grid := shrinkGray(t, phashSize, phashSize)
+
+	// Separable DCT, keeping only the low frequencies: rows, then columns
+	var rows [phashSize][phashBits]float64
+	for y := range phashSize {
+		for u := range phashBits {
+			var sum float64
+			for x := range phashSize {
+				sum += grid[y*phashSize+x] * phashCos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+
+	coeffs := make([]float64, 0, phashBits*phashBits)
+	for v := range phashBits {
+		for u := range phashBits {
+			var sum float64
+			for y := range phashSize {
+				sum += rows[y][u] * phashCos[v][y]
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+
+	// The DC term only reflects average brightness; leave it out of the median
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for _, c := range coeffs {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+func hashSimilarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// Histogram compares color histograms of the unmasked pixels by
+// intersection, with 4 levels per channel (64 bins). It ignores where colors
+// are, so it is robust to small motion but misses rearrangements of the same
+// content.
+type Histogram struct{}
+
+// Name implements Similarity
+func (Histogram) Name() string { return MetricHistogram }
+
+// Compare implements Similarity
+func (Histogram) Compare(a, b *Thumbnail) float64 {
+	ha, hb := colorHistogram(a), colorHistogram(b)
+	if ha == nil || hb == nil {
+		// Nothing left to compare once masked
+		return 1
+	}
+
+	var intersection float64
+	for i := range ha {
+		intersection += min(ha[i], hb[i])
+	}
+	return intersection
+}
+
+// colorHistogram returns the normalized 64-bin color histogram of the
+// unmasked pixels
+func colorHistogram(t *Thumbnail) []float64 {
+	hist := make([]float64, 64)
+	var counted int
+	for i := range len(t.RGB) / 3 {
+		if t.ignored(i) {
+			continue
+		}
+		r, g, b := t.RGB[3*i]>>6, t.RGB[3*i+1]>>6, t.RGB[3*i+2]>>6
+		hist[int(r)<<4|int(g)<<2|int(b)]++
+		counted++
+	}
+	if counted == 0 {
+		return nil
+	}
+	for i := range hist {
+		hist[i] /= float64(counted)
+	}
+	return hist
+}
+
+// shrinkGray averages the thumbnail's unmasked luminance down to a width x
+// height grid. Cells with no unmasked pixels get the overall mean, so they
+// look the same in every frame.
+func shrinkGray(t *Thumbnail, width, height int) []float64 {
+	grid := make([]float64, width*height)
+	counts := make([]int, width*height)
+	var sum float64
+	var counted int
+	for y := range t.Height {
+		gy := y * height / t.Height
+		for x := range t.Width {
+			i := y*t.Width + x
+			if t.ignored(i) {
+				continue
+			}
+			gx := x * width / t.Width
+			grid[gy*width+gx] += t.Gray[i]
+			counts[gy*width+gx]++
+			sum += t.Gray[i]
+			counted++
+		}
+	}
+
+	var mean float64
+	if counted > 0 {
+		mean = sum / float64(counted)
+	}
+	for i := range grid {
+		if counts[i] > 0 {
+			grid[i] /= float64(counts[i])
+		} else {
+			grid[i] = mean
+		}
+	}
+	return grid
+}
@@ -0,0 +1,154 @@
+package video
+
+import (
+	"math"
+	"testing"
+)
+
+// makeThumbnail builds a thumbnail from a function giving each pixel's color
+func makeThumbnail(width, height int, pixel func(x, y int) (r, g, b uint8)) *Thumbnail {
+	rgb := make([]uint8, 0, 3*width*height)
+	for y := range height {
+		for x := range width {
+			r, g, b := pixel(x, y)
+			rgb = append(rgb, r, g, b)
+		}
+	}
+	return newThumbnail(width, height, rgb)
+}
+
+func solid(r, g, b uint8) func(x, y int) (uint8, uint8, uint8) {
+	return func(_, _ int) (uint8, uint8, uint8) { return r, g, b }
+}
+
+func horizontalGradient(x, _ int) (uint8, uint8, uint8) {
+	v := uint8(x * 4)
+	return v, v, v
+}
+
+func mirroredGradient(x, _ int) (uint8, uint8, uint8) {
+	v := uint8(252 - x*4)
+	return v, v, v
+}
+
+// waves is smooth, photo-like content with energy at low frequencies
+func waves(x, y int) (uint8, uint8, uint8) {
+	v := uint8(128 + 50*math.Sin(float64(x)/7) + 50*math.Cos(float64(y)/5))
+	return v, v / 2, 255 - v
+}
+
+// checkerboard has 8x8 squares of light and dark gray
+func checkerboard(x, y int) (uint8, uint8, uint8) {
+	if (x/8+y/8)%2 == 0 {
+		return 220, 220, 220
+	}
+	return 30, 30, 30
+}
+
+func TestParseMetric(t *testing.T) {
+	for _, name := range []string{"ncc", "ssim", "dhash", "phash", "histogram", "SSIM"} {
+		metric, err := ParseMetric(name)
+		if err != nil {
+			t.Errorf("ParseMetric(%q) failed: %v", name, err)
+			continue
+		}
+		if metric.Name() == "" {
+			t.Errorf("ParseMetric(%q) returned a metric without a name", name)
+		}
+	}
+	if _, err := ParseMetric("mse"); err == nil {
+		t.Error("Expected error for unknown metric")
+	}
+}
+
+func TestMetricsIdentical(t *testing.T) {
+	img := makeThumbnail(64, 64, checkerboard)
+	for _, metric := range []Similarity{NCC{}, SSIM{}, DHash{}, PHash{}, Histogram{}} {
+		if score := metric.Compare(img, img); math.Abs(score-1) > 1e-9 {
+			t.Errorf("%s: expected 1 for identical images, got %f", metric.Name(), score)
+		}
+	}
+}
+
+func TestMetricsStructuralChange(t *testing.T) {
+	// Same brightness range, different layout
+	a := makeThumbnail(64, 64, horizontalGradient)
+	b := makeThumbnail(64, 64, mirroredGradient)
+	for _, metric := range []Similarity{NCC{}, SSIM{}, DHash{}, PHash{}} {
+		if score := metric.Compare(a, b); score > 0.75 {
+			t.Errorf("%s: expected a low score for mirrored gradients, got %f", metric.Name(), score)
+		}
+	}
+
+	// The pixels are the same colors, just rearranged
+	if score := (Histogram{}).Compare(a, b); math.Abs(score-1) > 1e-9 {
+		t.Errorf("histogram: expected 1 for rearranged pixels, got %f", score)
+	}
+}
+
+func TestMetricsFlatSlides(t *testing.T) {
+	// Switching between solid-color slides: NCC can't see it, SSIM and
+	// histograms can
+	black := makeThumbnail(64, 64, solid(0, 0, 0))
+	white := makeThumbnail(64, 64, solid(255, 255, 255))
+	red := makeThumbnail(64, 64, solid(200, 0, 0))
+	green := makeThumbnail(64, 64, solid(0, 200, 0))
+
+	if score := (NCC{}).Compare(black, white); score != 1 {
+		t.Errorf("ncc: expected flat images to score 1, got %f", score)
+	}
+	if score := (SSIM{}).Compare(black, white); score > 0.1 {
+		t.Errorf("ssim: expected a low score for black vs white, got %f", score)
+	}
+	if score := (Histogram{}).Compare(black, white); score != 0 {
+		t.Errorf("histogram: expected 0 for black vs white, got %f", score)
+	}
+	if score := (Histogram{}).Compare(red, green); score != 0 {
+		t.Errorf("histogram: expected 0 for red vs green, got %f", score)
+	}
+}
+
+func TestMetricsFade(t *testing.T) {
+	// Dimming the same content: NCC ignores it, SSIM notices
+	bright := makeThumbnail(64, 64, checkerboard)
+	dim := makeThumbnail(64, 64, func(x, y int) (uint8, uint8, uint8) {
+		r, g, b := checkerboard(x, y)
+		return r / 4, g / 4, b / 4
+	})
+
+	if score := (NCC{}).Compare(bright, dim); score < 0.99 {
+		t.Errorf("ncc: expected ~1 for a uniform dimming, got %f", score)
+	}
+	if score := (SSIM{}).Compare(bright, dim); score > 0.85 {
+		t.Errorf("ssim: expected a dimming to fall below 0.85, got %f", score)
+	}
+}
+
+func TestHashesTolerateSmallChanges(t *testing.T) {
+	// A slight brightness shift keeps the hash structure
+	a := makeThumbnail(64, 64, waves)
+	b := makeThumbnail(64, 64, func(x, y int) (uint8, uint8, uint8) {
+		r, g, bl := waves(x, y)
+		return r + 10, g + 5, bl - 10
+	})
+
+	for _, metric := range []Similarity{DHash{}, PHash{}} {
+		if score := metric.Compare(a, b); score < 0.95 {
+			t.Errorf("%s: expected a small change to score high, got %f", metric.Name(), score)
+		}
+	}
+}
+
+func TestShrinkGray(t *testing.T) {
+	img := makeThumbnail(4, 2, func(x, _ int) (uint8, uint8, uint8) {
+		if x < 2 {
+			return 0, 0, 0
+		}
+		return 255, 255, 255
+	})
+
+	grid := shrinkGray(img, 2, 1)
+	if len(grid) != 2 || grid[0] != 0 || math.Abs(grid[1]-1) > 1e-9 {
+		t.Errorf("Expected [0 1], got %v", grid)
+	}
+}
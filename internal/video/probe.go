@@ -0,0 +1,238 @@
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaInfo describes an input's container and streams, as reported by
+// ffprobe. Fields ffprobe leaves out are zero.
+type MediaInfo struct {
+	// Container is the format ffmpeg demuxes the input as, such as "mp4" or
+	// "matroska"
+	Container string
+	Duration  time.Duration
+	BitRate   int64 // Overall bits per second
+	Title     string
+	// CreationTime is when the recording was made, from the container tags
+	CreationTime time.Time
+	Video        *VideoStream // nil if the input has no video
+	Audio        *AudioStream // nil if the input has no audio
+	Chapters     []Chapter
+}
+
+// VideoStream describes the first video stream
+type VideoStream struct {
+	Codec string
+	// Width and Height are the coded size, before Rotation is applied
+	Width     int
+	Height    int
+	FrameRate float64
+	// Rotation is how far players turn the picture clockwise for display:
+	// 0, 90, 180 or 270 degrees. ffmpeg applies it when decoding.
+	Rotation int
+}
+
+// AudioStream describes the first audio stream
+type AudioStream struct {
+	Codec         string
+	Channels      int
+	ChannelLayout string // Such as "stereo" or "5.1"
+	SampleRate    int    // Hz
+}
+
+// Chapter is a chapter marker embedded in the container
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
+// DisplaySize returns the picture's size once Rotation is applied, which is
+// the size of decoded frames
+func (v VideoStream) DisplaySize() (width, height int) {
+	if v.Rotation == 90 || v.Rotation == 270 {
+		return v.Height, v.Width
+	}
+	return v.Width, v.Height
+}
+
+// Probe describes an input file or URL using ffprobe
+func Probe(inputPath string) (MediaInfo, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-show_chapters",
+		inputPath,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return MediaInfo{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	return parseProbe(output, inputPath)
+}
+
+// probeOutput is the subset of ffprobe's JSON output that Probe reads
+type probeOutput struct {
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		RFrameRate    string            `json:"r_frame_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		SampleRate    string            `json:"sample_rate"`
+		Tags          map[string]string `json:"tags"`
+		Disposition   struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+}
+
+func parseProbe(data []byte, inputPath string) (MediaInfo, error) {
+	var probe probeOutput
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return MediaInfo{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	info := MediaInfo{
+		Container: containerName(probe.Format.FormatName, inputPath),
+		Duration:  parseSeconds(probe.Format.Duration),
+		Title:     tag(probe.Format.Tags, "title"),
+	}
+	info.BitRate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	if created := tag(probe.Format.Tags, "creation_time"); created != "" {
+		info.CreationTime, _ = time.Parse(time.RFC3339Nano, created)
+	}
+
+	for _, s := range probe.Streams {
+		switch s.CodecType {
+		case "video":
+			// Cover art in audio files is a video stream of one picture
+			if info.Video != nil || s.Disposition.AttachedPic != 0 {
+				continue
+			}
+			info.Video = &VideoStream{
+				Codec:     s.CodecName,
+				Width:     s.Width,
+				Height:    s.Height,
+				FrameRate: parseRational(s.AvgFrameRate),
+			}
+			if info.Video.FrameRate == 0 {
+				info.Video.FrameRate = parseRational(s.RFrameRate)
+			}
+			// Newer ffprobe reports a display matrix, which turns the
+			// other way; older versions a rotate tag
+			if rotate, err := strconv.Atoi(tag(s.Tags, "rotate")); err == nil {
+				info.Video.Rotation = normalizeRotation(rotate)
+			}
+			for _, sd := range s.SideDataList {
+				if sd.Rotation != 0 {
+					info.Video.Rotation = normalizeRotation(-int(sd.Rotation))
+				}
+			}
+		case "audio":
+			if info.Audio != nil {
+				continue
+			}
+			sampleRate, _ := strconv.Atoi(s.SampleRate)
+			info.Audio = &AudioStream{
+				Codec:         s.CodecName,
+				Channels:      s.Channels,
+				ChannelLayout: s.ChannelLayout,
+				SampleRate:    sampleRate,
+			}
+		}
+	}
+
+	for _, c := range probe.Chapters {
+		info.Chapters = append(info.Chapters, Chapter{
+			Start: parseSeconds(c.StartTime),
+			End:   parseSeconds(c.EndTime),
+			Title: tag(c.Tags, "title"),
+		})
+	}
+
+	if info.Duration == 0 && info.Video == nil && info.Audio == nil {
+		return MediaInfo{}, fmt.Errorf("no audio or video streams found")
+	}
+
+	return info, nil
+}
+
+// containerName picks the format matching the input's extension from
+// ffprobe's format_name, which lists every format the demuxer handles (such
+// as "mov,mp4,m4a,3gp,3g2,mj2"), falling back to the first
+func containerName(formatName, inputPath string) string {
+	names := strings.Split(formatName, ",")
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(inputPath), "."))
+	for _, name := range names {
+		if name == ext {
+			return name
+		}
+	}
+	return names[0]
+}
+
+// tag looks up a metadata tag, whose key case varies by container
+func tag(tags map[string]string, key string) string {
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func parseSeconds(s string) time.Duration {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// parseRational parses an ffprobe rate such as "30000/1001"
+func parseRational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		v, _ := strconv.ParseFloat(s, 64)
+		return v
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// normalizeRotation maps degrees onto 0, 90, 180 or 270
+func normalizeRotation(degrees int) int {
+	return ((degrees % 360) + 360) % 360 / 90 * 90
+}
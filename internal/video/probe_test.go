@@ -0,0 +1,186 @@
+package video
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	// Skip if ffprobe is not available
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not found, skipping test")
+	}
+
+	testVideo := createTestVideo(t)
+	defer func() { _ = os.Remove(testVideo) }()
+
+	info, err := Probe(testVideo)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+
+	// Test video should be approximately 1 second
+	if info.Duration < 500*time.Millisecond || info.Duration > 2*time.Second {
+		t.Errorf("Expected duration around 1s, got %v", info.Duration)
+	}
+	if info.Container != "mp4" {
+		t.Errorf("Container = %q, want mp4", info.Container)
+	}
+	if info.Video == nil {
+		t.Fatal("Expected a video stream")
+	}
+	if info.Video.Width != 320 || info.Video.Height != 240 {
+		t.Errorf("Video size = %dx%d, want 320x240", info.Video.Width, info.Video.Height)
+	}
+	if info.Video.FrameRate != 30 {
+		t.Errorf("FrameRate = %v, want 30", info.Video.FrameRate)
+	}
+	if info.Audio != nil {
+		t.Errorf("Expected no audio stream, got %+v", info.Audio)
+	}
+}
+
+func TestProbeURL(t *testing.T) {
+	// Skip if ffprobe is not available
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not found, skipping test")
+	}
+
+	testVideo := createTestVideo(t)
+	defer func() { _ = os.Remove(testVideo) }()
+
+	// ffprobe reads http inputs itself
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Dir(testVideo))))
+	defer server.Close()
+
+	info, err := Probe(server.URL + "/" + filepath.Base(testVideo))
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if info.Duration < 500*time.Millisecond || info.Duration > 2*time.Second {
+		t.Errorf("Expected duration around 1s, got %v", info.Duration)
+	}
+}
+
+func TestProbeNonexistent(t *testing.T) {
+	_, err := Probe("/nonexistent/video.mp4")
+	if err == nil {
+		t.Error("Expected error for nonexistent file")
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	data := `{
+		"streams": [
+			{"codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080,
+			 "avg_frame_rate": "30000/1001", "r_frame_rate": "30/1",
+			 "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]},
+			{"codec_type": "audio", "codec_name": "aac", "channels": 2,
+			 "channel_layout": "stereo", "sample_rate": "48000"},
+			{"codec_type": "audio", "codec_name": "opus", "channels": 1, "sample_rate": "16000"}
+		],
+		"chapters": [
+			{"start_time": "0.000000", "end_time": "65.500000", "tags": {"title": "Intro"}},
+			{"start_time": "65.500000", "end_time": "120.000000", "tags": {"TITLE": "Demo"}}
+		],
+		"format": {
+			"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "120.000000", "bit_rate": "2500000",
+			"tags": {"title": " Team sync ", "creation_time": "2024-03-01T14:05:00.000000Z"}
+		}
+	}`
+
+	info, err := parseProbe([]byte(data), "/recordings/IMG_0001.MOV")
+	if err != nil {
+		t.Fatalf("parseProbe failed: %v", err)
+	}
+
+	if info.Container != "mov" {
+		t.Errorf("Container = %q, want mov", info.Container)
+	}
+	if info.Duration != 120*time.Second {
+		t.Errorf("Duration = %v, want 2m0s", info.Duration)
+	}
+	if info.BitRate != 2500000 {
+		t.Errorf("BitRate = %d, want 2500000", info.BitRate)
+	}
+	if info.Title != "Team sync" {
+		t.Errorf("Title = %q, want Team sync", info.Title)
+	}
+	if want := time.Date(2024, 3, 1, 14, 5, 0, 0, time.UTC); !info.CreationTime.Equal(want) {
+		t.Errorf("CreationTime = %v, want %v", info.CreationTime, want)
+	}
+
+	if info.Video == nil {
+		t.Fatal("Expected a video stream")
+	}
+	if info.Video.Codec != "hevc" || info.Video.Rotation != 90 {
+		t.Errorf("Video = %+v, want hevc rotated 90", *info.Video)
+	}
+	if fps := info.Video.FrameRate; fps < 29.96 || fps > 29.98 {
+		t.Errorf("FrameRate = %v, want 29.97", fps)
+	}
+	if w, h := info.Video.DisplaySize(); w != 1080 || h != 1920 {
+		t.Errorf("DisplaySize = %dx%d, want 1080x1920", w, h)
+	}
+
+	// The first audio stream is reported
+	want := AudioStream{Codec: "aac", Channels: 2, ChannelLayout: "stereo", SampleRate: 48000}
+	if info.Audio == nil || *info.Audio != want {
+		t.Errorf("Audio = %+v, want %+v", info.Audio, want)
+	}
+
+	wantChapters := []Chapter{
+		{Start: 0, End: 65500 * time.Millisecond, Title: "Intro"},
+		{Start: 65500 * time.Millisecond, End: 120 * time.Second, Title: "Demo"},
+	}
+	if len(info.Chapters) != len(wantChapters) {
+		t.Fatalf("Chapters = %+v, want %+v", info.Chapters, wantChapters)
+	}
+	for i, c := range info.Chapters {
+		if c != wantChapters[i] {
+			t.Errorf("Chapters[%d] = %+v, want %+v", i, c, wantChapters[i])
+		}
+	}
+}
+
+func TestParseProbeAudioWithCoverArt(t *testing.T) {
+	data := `{
+		"streams": [
+			{"codec_type": "audio", "codec_name": "mp3", "channels": 2, "sample_rate": "44100"},
+			{"codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600,
+			 "disposition": {"attached_pic": 1}}
+		],
+		"format": {"format_name": "mp3", "duration": "1800.5"}
+	}`
+
+	info, err := parseProbe([]byte(data), "podcast.mp3")
+	if err != nil {
+		t.Fatalf("parseProbe failed: %v", err)
+	}
+	if info.Video != nil {
+		t.Errorf("Cover art reported as video: %+v", info.Video)
+	}
+	if info.Audio == nil || info.Audio.Codec != "mp3" {
+		t.Errorf("Audio = %+v, want mp3", info.Audio)
+	}
+}
+
+func TestParseProbeNoStreams(t *testing.T) {
+	if _, err := parseProbe([]byte(`{"format": {}}`), "empty.bin"); err == nil {
+		t.Error("Expected error for input without streams")
+	}
+}
+
+func TestNormalizeRotation(t *testing.T) {
+	tests := map[int]int{0: 0, 90: 90, -90: 270, 180: 180, -180: 180, 270: 270, 360: 0, 450: 90}
+	for in, want := range tests {
+		if got := normalizeRotation(in); got != want {
+			t.Errorf("normalizeRotation(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
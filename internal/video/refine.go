@@ -0,0 +1,121 @@
+package video
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyframeChoice selects which frame is saved for a detected change
+type KeyframeChoice string
+
+const (
+	// ChooseFirst saves the frame where the change was detected
+	ChooseFirst KeyframeChoice = "first"
+	// ChooseSharpest saves the sharpest frame before the content settles
+	ChooseSharpest KeyframeChoice = "sharpest"
+	// ChooseStable saves the first frame after which the content stops
+	// changing
+	ChooseStable KeyframeChoice = "stable"
+)
+
+// ParseKeyframeChoice validates a keyframe choice name
+func ParseKeyframeChoice(name string) (KeyframeChoice, error) {
+	switch c := KeyframeChoice(strings.ToLower(name)); c {
+	case ChooseFirst, ChooseSharpest, ChooseStable:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unsupported keyframe choice %q: must be first, sharpest or stable", name)
+	}
+}
+
+// RefineOptions controls which frame RefineKeyframes saves for each change
+type RefineOptions struct {
+	Choice KeyframeChoice
+	// Window is the most frames after the change to consider
+	Window int
+	// Settle is the similarity with the next frame at which the content
+	// counts as settled
+	Settle float64
+}
+
+// RefineKeyframes moves each keyframe to a better frame of its change: the
+// sharpest or the most stable one between the change and the point where the
+// content settles, looking at most opts.Window frames ahead and never past the
+// next keyframe. Timestamp keeps the time of the change; Index and
+// ImageTimestamp move to the chosen frame. The frames must carry the
+// Sharpness and PrevSimilarity recorded when they were scored. The last
+// keyframe is left alone, since it marks the end of the video.
+func RefineKeyframes(frames []Frame, keyframes []Keyframe, opts RefineOptions) []Keyframe {
+	if opts.Choice == ChooseFirst || opts.Choice == "" || opts.Window <= 0 || len(keyframes) < 2 {
+		return keyframes
+	}
+
+	positions := make(map[int]int, len(frames))
+	for i, f := range frames {
+		positions[f.Index] = i
+	}
+
+	refined := make([]Keyframe, len(keyframes))
+	copy(refined, keyframes)
+
+	for k := 0; k < len(refined)-1; k++ {
+		start, ok := positions[refined[k].Index]
+		if !ok {
+			continue
+		}
+		end := min(start+opts.Window, len(frames)-1)
+		if next, ok := positions[refined[k+1].Index]; ok {
+			end = min(end, next-1)
+		}
+
+		// Candidates run up to the first frame whose successor looks the same
+		settled := end
+		for i := start; i < end; i++ {
+			if frames[i+1].PrevSimilarity >= opts.Settle {
+				settled = i
+				break
+			}
+		}
+
+		chosen := settled
+		if opts.Choice == ChooseSharpest {
+			chosen = start
+			for i := start + 1; i <= settled; i++ {
+				if frames[i].Sharpness > frames[chosen].Sharpness {
+					chosen = i
+				}
+			}
+		}
+
+		refined[k].Index = frames[chosen].Index
+		refined[k].ImageTimestamp = frames[chosen].Timestamp
+	}
+
+	return refined
+}
+
+// sharpness returns the variance of the 4-neighbor Laplacian of the
+// thumbnail's luminance. Motion blur and mid-transition frames score low.
+// Pixels next to masked ones are left out.
+func sharpness(t *Thumbnail) float64 {
+	var sum, sumSq float64
+	var n int
+	for y := 1; y < t.Height-1; y++ {
+		for x := 1; x < t.Width-1; x++ {
+			i := y*t.Width + x
+			if t.ignored(i) || t.ignored(i-1) || t.ignored(i+1) || t.ignored(i-t.Width) || t.ignored(i+t.Width) {
+				continue
+			}
+			lap := t.Gray[i-1] + t.Gray[i+1] + t.Gray[i-t.Width] + t.Gray[i+t.Width] - 4*t.Gray[i]
+			sum += lap
+			sumSq += lap * lap
+			n++
+		}
+	}
+
+	if n == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
@@ -0,0 +1,115 @@
+package video
+
+import (
+	"testing"
+	"time"
+)
+
+// refineFrames builds frames with the given sharpness and similarity to the
+// previous frame
+func refineFrames(sharpness, prevSimilarity []float64) []Frame {
+	frames := make([]Frame, len(sharpness))
+	for i := range frames {
+		frames[i] = Frame{
+			Index:          i + 1,
+			Timestamp:      time.Duration(i) * time.Second,
+			Sharpness:      sharpness[i],
+			PrevSimilarity: prevSimilarity[i],
+		}
+	}
+	return frames
+}
+
+func TestParseKeyframeChoice(t *testing.T) {
+	for _, name := range []string{"first", "sharpest", "Stable"} {
+		if _, err := ParseKeyframeChoice(name); err != nil {
+			t.Errorf("ParseKeyframeChoice(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := ParseKeyframeChoice("best"); err == nil {
+		t.Error("Expected error for unknown keyframe choice")
+	}
+}
+
+func TestRefineKeyframes(t *testing.T) {
+	// A transition detected at frame 3 animates until frame 5, which matches
+	// frame 6; frame 4 is the sharpest along the way
+	frames := refineFrames(
+		[]float64{5, 5, 1, 9, 6, 6, 6, 6, 6, 6},
+		[]float64{0, 0.99, 0.4, 0.8, 0.9, 0.99, 0.99, 0.99, 0.99, 0.99},
+	)
+	keyframes := SelectKeyframes(frames, []float64{0, 0.99, 0.4, 0.8, 0.9, 0.99, 0.99, 0.99, 0.99, 0.99}, 0.5)
+	if len(keyframes) != 3 || keyframes[1].Index != 3 {
+		t.Fatalf("Unexpected keyframes: %+v", keyframes)
+	}
+
+	sharpest := RefineKeyframes(frames, keyframes, RefineOptions{Choice: ChooseSharpest, Window: 5, Settle: 0.95})
+	if sharpest[1].Index != 4 {
+		t.Errorf("Expected sharpest frame 4, got %d", sharpest[1].Index)
+	}
+	if sharpest[1].Timestamp != 2*time.Second || sharpest[1].ImageTimestamp != 3*time.Second {
+		t.Errorf("Expected change at 2s with image at 3s, got %v and %v", sharpest[1].Timestamp, sharpest[1].ImageTimestamp)
+	}
+
+	stable := RefineKeyframes(frames, keyframes, RefineOptions{Choice: ChooseStable, Window: 5, Settle: 0.95})
+	if stable[1].Index != 5 {
+		t.Errorf("Expected first settled frame 5, got %d", stable[1].Index)
+	}
+
+	// The original keyframes and the final frame are left alone
+	if keyframes[1].Index != 3 {
+		t.Error("RefineKeyframes modified its input")
+	}
+	if last := stable[len(stable)-1]; last.Index != 10 {
+		t.Errorf("Expected last keyframe to stay at frame 10, got %d", last.Index)
+	}
+}
+
+func TestRefineKeyframesWindow(t *testing.T) {
+	// Content never settles: the window bounds the search and the next
+	// keyframe is never overtaken
+	frames := refineFrames(
+		[]float64{1, 2, 3, 4, 5, 6, 7, 8},
+		[]float64{0, 0.6, 0.6, 0.6, 0.6, 0.6, 0.6, 0.6},
+	)
+	keyframes := []Keyframe{{Index: 1}, {Index: 5}, {Index: 8}}
+
+	refined := RefineKeyframes(frames, keyframes, RefineOptions{Choice: ChooseSharpest, Window: 2, Settle: 0.95})
+	if refined[0].Index != 3 {
+		t.Errorf("Expected window to stop at frame 3, got %d", refined[0].Index)
+	}
+	if refined[1].Index != 7 {
+		t.Errorf("Expected search to stop before the next keyframe at frame 7, got %d", refined[1].Index)
+	}
+
+	wide := RefineKeyframes(frames, keyframes, RefineOptions{Choice: ChooseSharpest, Window: 10, Settle: 0.95})
+	if wide[0].Index != 4 {
+		t.Errorf("Expected search to stop before the next keyframe at frame 4, got %d", wide[0].Index)
+	}
+}
+
+func TestRefineKeyframesFirst(t *testing.T) {
+	frames := refineFrames([]float64{1, 9}, []float64{0, 0.5})
+	keyframes := []Keyframe{{Index: 1}, {Index: 2}}
+	refined := RefineKeyframes(frames, keyframes, RefineOptions{Choice: ChooseFirst, Window: 5, Settle: 0.95})
+	if refined[0].Index != 1 {
+		t.Errorf("Expected first choice to keep frame 1, got %d", refined[0].Index)
+	}
+}
+
+func TestSharpness(t *testing.T) {
+	sharp := makeThumbnail(32, 32, checkerboard)
+	blurred := makeThumbnail(32, 32, func(x, y int) (uint8, uint8, uint8) {
+		// A soft ramp instead of hard edges
+		v := uint8(100 + x + y)
+		return v, v, v
+	})
+	flat := makeThumbnail(32, 32, solid(128, 128, 128))
+
+	if sharpness(sharp) <= sharpness(blurred) {
+		t.Errorf("Expected hard edges to be sharper: %f vs %f", sharpness(sharp), sharpness(blurred))
+	}
+	if sharpness(flat) != 0 {
+		t.Errorf("Expected flat image to have zero sharpness, got %f", sharpness(flat))
+	}
+}
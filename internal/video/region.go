@@ -0,0 +1,110 @@
+package video
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Region is a rectangle in coordinates relative to the frame, where 0,0 is
+// the top-left corner and 1,1 the bottom-right
+type Region struct {
+	X, Y, W, H float64
+}
+
+// ParseRegion parses "x,y,w,h" in relative coordinates, such as
+// "0.8,0,0.2,0.05" for the top-right corner of the frame
+func ParseRegion(s string) (Region, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return Region{}, fmt.Errorf("invalid region %q: expected x,y,w,h", s)
+	}
+
+	var values [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Region{}, fmt.Errorf("invalid region %q: %w", s, err)
+		}
+		values[i] = v
+	}
+
+	r := Region{X: values[0], Y: values[1], W: values[2], H: values[3]}
+	if err := r.validate(); err != nil {
+		return Region{}, fmt.Errorf("invalid region %q: %w", s, err)
+	}
+	return r, nil
+}
+
+func (r Region) validate() error {
+	const epsilon = 1e-9
+	if r.X < 0 || r.Y < 0 || r.W <= 0 || r.H <= 0 {
+		return fmt.Errorf("x and y must be at least 0 and w and h positive")
+	}
+	if r.X+r.W > 1+epsilon || r.Y+r.H > 1+epsilon {
+		return fmt.Errorf("region extends past the frame (coordinates are relative, 0-1)")
+	}
+	return nil
+}
+
+// pixels returns the pixel bounds of the region in a width x height image.
+// Edges are rounded outwards, so the whole region is always covered.
+func (r Region) pixels(width, height int) (x0, y0, x1, y1 int) {
+	x0 = max(0, int(math.Floor(r.X*float64(width))))
+	y0 = max(0, int(math.Floor(r.Y*float64(height))))
+	x1 = min(width, int(math.Ceil((r.X+r.W)*float64(width))))
+	y1 = min(height, int(math.Ceil((r.Y+r.H)*float64(height))))
+	return x0, y0, x1, y1
+}
+
+// hasRegions reports whether the options crop or mask thumbnails
+func (o DetectOptions) hasRegions() bool {
+	return o.Crop != nil || len(o.Ignore) > 0
+}
+
+// applyRegions masks the ignored regions of a thumbnail and then crops it.
+// Ignored regions are relative to the full frame, not the crop.
+func (o DetectOptions) applyRegions(t *Thumbnail) *Thumbnail {
+	if !o.hasRegions() {
+		return t
+	}
+
+	var mask []bool
+	if len(o.Ignore) > 0 {
+		mask = make([]bool, t.Width*t.Height)
+		for _, r := range o.Ignore {
+			x0, y0, x1, y1 := r.pixels(t.Width, t.Height)
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					mask[y*t.Width+x] = true
+				}
+			}
+		}
+	}
+
+	if o.Crop == nil {
+		return &Thumbnail{Width: t.Width, Height: t.Height, Gray: t.Gray, RGB: t.RGB, Mask: mask}
+	}
+
+	x0, y0, x1, y1 := o.Crop.pixels(t.Width, t.Height)
+	width, height := max(1, x1-x0), max(1, y1-y0)
+	cropped := &Thumbnail{
+		Width:  width,
+		Height: height,
+		Gray:   make([]float64, 0, width*height),
+		RGB:    make([]uint8, 0, 3*width*height),
+	}
+	if mask != nil {
+		cropped.Mask = make([]bool, 0, width*height)
+	}
+	for y := y0; y < y0+height; y++ {
+		row := y * t.Width
+		cropped.Gray = append(cropped.Gray, t.Gray[row+x0:row+x0+width]...)
+		cropped.RGB = append(cropped.RGB, t.RGB[3*(row+x0):3*(row+x0+width)]...)
+		if mask != nil {
+			cropped.Mask = append(cropped.Mask, mask[row+x0:row+x0+width]...)
+		}
+	}
+	return cropped
+}
@@ -0,0 +1,108 @@
+package video
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseRegion(t *testing.T) {
+	r, err := ParseRegion("0.8, 0, 0.2, 0.05")
+	if err != nil {
+		t.Fatalf("ParseRegion failed: %v", err)
+	}
+	if r != (Region{X: 0.8, Y: 0, W: 0.2, H: 0.05}) {
+		t.Errorf("Unexpected region: %+v", r)
+	}
+
+	for _, spec := range []string{"", "0,0,1", "a,0,1,1", "0,0,0,1", "-0.1,0,0.5,0.5", "0.5,0.5,0.6,0.5"} {
+		if _, err := ParseRegion(spec); err == nil {
+			t.Errorf("Expected error for region %q", spec)
+		}
+	}
+}
+
+func TestApplyRegionsMask(t *testing.T) {
+	thumb := makeThumbnail(10, 10, checkerboard)
+	opts := DetectOptions{Ignore: []Region{{X: 0, Y: 0, W: 0.25, H: 0.5}}}
+
+	masked := opts.applyRegions(thumb)
+	if masked.Width != 10 || masked.Height != 10 {
+		t.Fatalf("Expected mask to keep 10x10, got %dx%d", masked.Width, masked.Height)
+	}
+
+	// Edges round outwards: 2.5 columns cover x 0-2
+	count := 0
+	for _, m := range masked.Mask {
+		if m {
+			count++
+		}
+	}
+	if count != 3*5 {
+		t.Errorf("Expected 15 masked pixels, got %d", count)
+	}
+	if !masked.Mask[4*10+2] || masked.Mask[5*10+0] || masked.Mask[0*10+3] {
+		t.Error("Mask covers the wrong pixels")
+	}
+}
+
+func TestApplyRegionsCrop(t *testing.T) {
+	thumb := makeThumbnail(10, 10, func(x, y int) (uint8, uint8, uint8) {
+		return uint8(x), uint8(y), 0
+	})
+	opts := DetectOptions{
+		Crop:   &Region{X: 0.5, Y: 0.2, W: 0.5, H: 0.3},
+		Ignore: []Region{{X: 0.9, Y: 0, W: 0.1, H: 1}},
+	}
+
+	cropped := opts.applyRegions(thumb)
+	if cropped.Width != 5 || cropped.Height != 3 {
+		t.Fatalf("Expected 5x3 crop, got %dx%d", cropped.Width, cropped.Height)
+	}
+	if cropped.RGB[0] != 5 || cropped.RGB[1] != 2 {
+		t.Errorf("Expected crop to start at (5,2), got (%d,%d)", cropped.RGB[0], cropped.RGB[1])
+	}
+
+	// The ignored right edge is relative to the full frame: the crop's last column
+	for y := range 3 {
+		for x := range 5 {
+			if want := x == 4; cropped.Mask[y*5+x] != want {
+				t.Errorf("Mask at (%d,%d) = %v, want %v", x, y, cropped.Mask[y*5+x], want)
+			}
+		}
+	}
+}
+
+func TestApplyRegionsNone(t *testing.T) {
+	thumb := makeThumbnail(4, 4, checkerboard)
+	if got := (DetectOptions{}).applyRegions(thumb); got != thumb {
+		t.Error("Expected thumbnail to be returned unchanged without regions")
+	}
+}
+
+func TestMetricsIgnoreMaskedChanges(t *testing.T) {
+	// A "clock" in the top-right corner changes; the rest of the frame doesn't
+	clock := func(digit uint8) func(x, y int) (uint8, uint8, uint8) {
+		return func(x, y int) (uint8, uint8, uint8) {
+			if x >= 48 && y < 16 {
+				return digit * 25, 255 - digit*25, digit * 10
+			}
+			return waves(x, y)
+		}
+	}
+	opts := DetectOptions{Ignore: []Region{{X: 0.75, Y: 0, W: 0.25, H: 0.25}}}
+
+	a := opts.applyRegions(makeThumbnail(64, 64, clock(1)))
+	b := opts.applyRegions(makeThumbnail(64, 64, clock(9)))
+	for _, metric := range []Similarity{NCC{}, SSIM{}, DHash{}, PHash{}, Histogram{}} {
+		if score := metric.Compare(a, b); math.Abs(score-1) > 1e-9 {
+			t.Errorf("%s: expected masked change to score 1, got %f", metric.Name(), score)
+		}
+	}
+
+	// Without the mask, the clock registers
+	unmaskedA := makeThumbnail(64, 64, clock(1))
+	unmaskedB := makeThumbnail(64, 64, clock(9))
+	if score := (SSIM{}).Compare(unmaskedA, unmaskedB); score > 0.999 {
+		t.Errorf("ssim: expected unmasked clock change to register, got %f", score)
+	}
+}
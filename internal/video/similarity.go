@@ -8,148 +8,299 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/nfnt/resize"
 )
 
+// DefaultComparisonSize is the default long edge, in pixels, of the
+// thumbnails frames are compared at
+const DefaultComparisonSize = 400
+
+// CompareMode selects what each frame is compared against
+type CompareMode string
+
 const (
-	// Comparison dimensions for faster processing
-	compWidth  = 200
-	compHeight = 400
+	// CompareConsecutive compares each frame with the one before it
+	CompareConsecutive CompareMode = "consecutive"
+	// CompareKeyframe compares each frame with the most recently accepted
+	// keyframe, so slow pans and gradual builds add up until they register
+	CompareKeyframe CompareMode = "keyframe"
+	// CompareBoth accepts a frame if either comparison falls below the
+	// threshold
+	CompareBoth CompareMode = "both"
 )
 
-// DetectKeyframes analyzes frames and returns those that differ significantly
-// from their predecessors based on normalized cross-correlation
-func DetectKeyframes(frames []Frame, threshold float64, onProgress ProgressFunc) ([]Keyframe, error) {
-	if len(frames) == 0 {
-		return nil, nil
+// ParseCompareMode validates a comparison mode name
+func ParseCompareMode(name string) (CompareMode, error) {
+	switch m := CompareMode(strings.ToLower(name)); m {
+	case CompareConsecutive, CompareKeyframe, CompareBoth:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unsupported comparison %q: must be consecutive, keyframe or both", name)
 	}
+}
 
-	var keyframes []Keyframe
+// DetectOptions controls keyframe detection
+type DetectOptions struct {
+	Threshold float64
+	Compare   CompareMode
+	Metric    Similarity // NCC if nil
+	// ComparisonSize is the long edge of comparison thumbnails, which keep
+	// the source aspect ratio. Zero means DefaultComparisonSize.
+	ComparisonSize int
+	// Crop limits comparison to a region of the frame if set
+	Crop *Region
+	// Ignore lists regions left out of comparison, such as a clock, cursor
+	// area or webcam overlay. Saved keyframes still show the full frame.
+	Ignore []Region
+}
 
-	// Always include first frame
-	keyframes = append(keyframes, Keyframe{
-		Path:      frames[0].Path,
-		Index:     frames[0].Index,
-		Timestamp: frames[0].Timestamp,
-	})
+func (o DetectOptions) metric() Similarity {
+	if o.Metric == nil {
+		return NCC{}
+	}
+	return o.Metric
+}
 
-	if len(frames) == 1 {
-		if onProgress != nil {
-			onProgress(1.0)
-		}
-		return keyframes, nil
+func (o DetectOptions) comparisonSize() int {
+	if o.ComparisonSize <= 0 {
+		return DefaultComparisonSize
 	}
+	return o.ComparisonSize
+}
 
-	// Load and process first frame
-	prevGray, err := loadAndProcessFrame(frames[0].Path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load first frame: %w", err)
+// ComparisonDimensions returns the size of the comparison thumbnail for a
+// frame: the frame's aspect ratio with the long edge at most longEdge. Frames
+// already smaller are not upscaled.
+func ComparisonDimensions(width, height, longEdge int) (thumbWidth, thumbHeight int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+	if width <= longEdge && height <= longEdge {
+		return width, height
 	}
 
-	total := len(frames) - 1
+	if width >= height {
+		return longEdge, max(1, int(math.Round(float64(height)*float64(longEdge)/float64(width))))
+	}
+	return max(1, int(math.Round(float64(width)*float64(longEdge)/float64(height)))), longEdge
+}
 
-	// Compare consecutive frames
-	for i := 1; i < len(frames); i++ {
-		currGray, err := loadAndProcessFrame(frames[i].Path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load frame %d: %w", i, err)
+// scorer turns consecutive-frame similarities into scores for the comparison
+// mode. Frames must be passed in order, since comparisons against the last
+// keyframe depend on which earlier frames were accepted.
+type scorer struct {
+	opts   DetectOptions
+	metric Similarity
+	key    *Thumbnail
+}
+
+func newScorer(opts DetectOptions, first *Thumbnail) *scorer {
+	return &scorer{opts: opts, metric: opts.metric(), key: first}
+}
+
+// score returns the score of the next frame given its similarity with the
+// previous frame, and makes it the reference if it scores below the
+// threshold. SelectOptions spacing and caps aren't applied here, so they
+// only agree with the reference when none are set.
+func (s *scorer) score(consecutive float64, curr *Thumbnail) float64 {
+	var score float64
+	switch s.opts.Compare {
+	case CompareKeyframe:
+		score = s.metric.Compare(s.key, curr)
+	case CompareBoth:
+		score = min(consecutive, s.metric.Compare(s.key, curr))
+	default:
+		score = consecutive
+	}
+
+	// Frames below the threshold become keyframes, and the new reference
+	if score < s.opts.Threshold {
+		s.key = curr
+	}
+	return score
+}
+
+// SelectKeyframes picks keyframes from precomputed StreamFrames scores. The
+// first and last frames are always included.
+func SelectKeyframes(frames []Frame, scores []float64, threshold float64) []Keyframe {
+	return SelectKeyframesWithOptions(frames, scores, SelectOptions{Threshold: threshold})
+}
+
+// SelectOptions controls which scored frames become keyframes. Spacing and
+// caps are only meaningful for CompareConsecutive scores; with the other
+// modes the reference frame was already chosen by threshold alone.
+type SelectOptions struct {
+	Threshold float64
+	// MinInterval is the least time between keyframes. A change sooner than
+	// that is deferred until the interval has passed, so the content it
+	// settles on is still captured. 0 means no minimum.
+	MinInterval time.Duration
+	// MaxInterval forces a keyframe after this long without one, so long
+	// static stretches still have a reference image. 0 means no maximum.
+	MaxInterval time.Duration
+	// MaxKeyframes keeps at most this many keyframes, the first frame and
+	// then the most dissimilar ones. 0 means no cap.
+	MaxKeyframes int
+}
+
+// SelectKeyframesWithOptions picks keyframes from precomputed StreamFrames
+// scores, applying the spacing and cap in opts. The first frame is always
+// included, and so is the last unless the cap drops it.
+func SelectKeyframesWithOptions(frames []Frame, scores []float64, opts SelectOptions) []Keyframe {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	newKeyframe := func(i int, similarity float64) Keyframe {
+		return Keyframe{
+			Index:      frames[i].Index,
+			Timestamp:  frames[i].Timestamp,
+			Similarity: similarity,
+
+			ImageTimestamp: frames[i].Timestamp,
 		}
+	}
 
-		// Compute normalized cross-correlation
-		correlation := normalizedCrossCorrelation(prevGray, currGray)
+	// Always include first frame
+	keyframes := []Keyframe{newKeyframe(0, 0)}
+
+	// Lowest score of a change deferred by the minimum interval
+	pending := false
+	var pendingScore float64
+
+	for i := 1; i < len(frames); i++ {
+		gap := frames[i].Timestamp - keyframes[len(keyframes)-1].Timestamp
 
 		// If correlation is below threshold, this is a keyframe (significant change)
-		if correlation < threshold {
-			keyframes = append(keyframes, Keyframe{
-				Path:      frames[i].Path,
-				Index:     frames[i].Index,
-				Timestamp: frames[i].Timestamp,
-			})
+		if scores[i] < opts.Threshold {
+			if !pending || scores[i] < pendingScore {
+				pendingScore = scores[i]
+			}
+			pending = true
 		}
 
-		prevGray = currGray
-
-		if onProgress != nil {
-			onProgress(float64(i) / float64(total))
+		switch {
+		case pending && gap >= opts.MinInterval:
+			keyframes = append(keyframes, newKeyframe(i, pendingScore))
+			pending = false
+		case opts.MaxInterval > 0 && gap >= opts.MaxInterval:
+			keyframes = append(keyframes, newKeyframe(i, scores[i]))
 		}
 	}
 
 	// Always include last frame if not already included
-	lastFrame := frames[len(frames)-1]
-	if len(keyframes) == 0 || keyframes[len(keyframes)-1].Index != lastFrame.Index {
-		keyframes = append(keyframes, Keyframe(lastFrame))
+	last := len(frames) - 1
+	if keyframes[len(keyframes)-1].Index != frames[last].Index {
+		similarity := scores[last]
+		if pending {
+			similarity = pendingScore
+		}
+		keyframes = append(keyframes, newKeyframe(last, similarity))
 	}
 
-	return keyframes, nil
+	if opts.MaxKeyframes > 0 && len(keyframes) > opts.MaxKeyframes {
+		keyframes = capKeyframes(keyframes, opts.MaxKeyframes)
+	}
+
+	return keyframes
+}
+
+// capKeyframes keeps the first keyframe and the n-1 most dissimilar others,
+// in their original order
+func capKeyframes(keyframes []Keyframe, n int) []Keyframe {
+	ranked := make([]int, len(keyframes)-1)
+	for i := range ranked {
+		ranked[i] = i + 1
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return keyframes[ranked[i]].Similarity < keyframes[ranked[j]].Similarity
+	})
+
+	kept := append([]int{0}, ranked[:n-1]...)
+	sort.Ints(kept)
+
+	capped := make([]Keyframe, len(kept))
+	for i, k := range kept {
+		capped[i] = keyframes[k]
+	}
+	return capped
 }
 
-// loadAndProcessFrame loads an image, resizes it, and converts to grayscale
-func loadAndProcessFrame(path string) ([]float64, error) {
+// FrameSize returns the pixel dimensions of a frame image without decoding it
+func FrameSize(path string) (width, height int, err error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
 	defer func() { _ = file.Close() }()
 
-	var img image.Image
-
+	var cfg image.Config
 	ext := filepath.Ext(path)
 	switch ext {
 	case ".png":
-		img, err = png.Decode(file)
+		cfg, err = png.DecodeConfig(file)
 	case ".jpg", ".jpeg":
-		img, err = jpeg.Decode(file)
+		cfg, err = jpeg.DecodeConfig(file)
 	default:
-		return nil, fmt.Errorf("unsupported image format: %s", ext)
+		return 0, 0, fmt.Errorf("unsupported image format: %s", ext)
 	}
-
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
 
-	// Resize for faster comparison
-	resized := resize.Resize(compWidth, compHeight, img, resize.Bilinear)
-
-	// Convert to grayscale values
-	bounds := resized.Bounds()
-	gray := make([]float64, bounds.Dx()*bounds.Dy())
+	return cfg.Width, cfg.Height, nil
+}
 
-	idx := 0
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := resized.At(x, y).RGBA()
-			// Standard grayscale conversion
-			luminance := 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
-			gray[idx] = luminance / 65535.0 // Normalize to 0-1
-			idx++
-		}
+// ScaledSize returns the dimensions SaveKeyframes produces for a frame of the
+// given size at the given scale
+func ScaledSize(width, height int, scale float64) (scaledWidth, scaledHeight int) {
+	if scale == 1.0 {
+		return width, height
 	}
-
-	return gray, nil
+	return int(float64(width) * scale), int(float64(height) * scale)
 }
 
 // normalizedCrossCorrelation computes NCC between two grayscale images
 // Returns a value between -1 and 1, where 1 means identical
 func normalizedCrossCorrelation(a, b []float64) float64 {
+	return maskedCrossCorrelation(a, b, nil)
+}
+
+// maskedCrossCorrelation computes NCC over the pixels not set in mask. A nil
+// mask includes every pixel.
+func maskedCrossCorrelation(a, b []float64, mask []bool) float64 {
 	if len(a) != len(b) || len(a) == 0 {
 		return 0
 	}
 
-	n := float64(len(a))
-
 	// Compute means
 	var sumA, sumB float64
+	var count int
 	for i := range a {
+		if mask != nil && mask[i] {
+			continue
+		}
 		sumA += a[i]
 		sumB += b[i]
+		count++
+	}
+	if count == 0 {
+		return 1.0 // Nothing left to compare once masked
 	}
+	n := float64(count)
 	meanA := sumA / n
 	meanB := sumB / n
 
 	// Compute standard deviations and cross-correlation
 	var sumProduct, sumSqA, sumSqB float64
 	for i := range a {
+		if mask != nil && mask[i] {
+			continue
+		}
 		diffA := a[i] - meanA
 		diffB := b[i] - meanB
 		sumProduct += diffA * diffB
@@ -171,10 +322,14 @@ func normalizedCrossCorrelation(a, b []float64) float64 {
 	return ncc
 }
 
-// SaveKeyframes saves keyframes as JPEGs with optional scaling and quality settings
+// SaveKeyframes saves keyframes as JPEGs with optional scaling and quality
+// settings. Repeats marked by DedupeKeyframes are skipped.
 func SaveKeyframes(keyframes []Keyframe, outputDir string, quality int, scale float64, onProgress ProgressFunc) error {
 	total := len(keyframes)
 	for i, kf := range keyframes {
+		if kf.DuplicateOf != 0 {
+			continue
+		}
 		if err := saveKeyframe(kf, outputDir, quality, scale); err != nil {
 			return err
 		}
@@ -211,9 +366,8 @@ func saveKeyframe(kf Keyframe, outputDir string, quality int, scale float64) err
 	// Scale if needed
 	if scale != 1.0 {
 		bounds := img.Bounds()
-		newWidth := uint(float64(bounds.Dx()) * scale)
-		newHeight := uint(float64(bounds.Dy()) * scale)
-		img = resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
+		newWidth, newHeight := ScaledSize(bounds.Dx(), bounds.Dy(), scale)
+		img = resize.Resize(uint(newWidth), uint(newHeight), img, resize.Lanczos3)
 	}
 
 	// Save as JPEG
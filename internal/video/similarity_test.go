@@ -6,106 +6,19 @@ import (
 	"image/png"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 )
 
-func TestDetectKeyframesEmpty(t *testing.T) {
-	keyframes, err := DetectKeyframes(nil, 0.85, nil)
-	if err != nil {
-		t.Errorf("Unexpected error: %v", err)
-	}
-	if len(keyframes) != 0 {
-		t.Errorf("Expected empty keyframes, got %d", len(keyframes))
-	}
-}
-
-func TestDetectKeyframesSingleFrame(t *testing.T) {
-	tempDir := t.TempDir()
-	framePath := createTestImage(t, tempDir, "0001.png", color.RGBA{255, 0, 0, 255})
-
-	frames := []Frame{{
-		Path:      framePath,
-		Index:     1,
-		Timestamp: 0,
-	}}
-
-	keyframes, err := DetectKeyframes(frames, 0.85, nil)
-	if err != nil {
-		t.Fatalf("DetectKeyframes failed: %v", err)
-	}
-
-	if len(keyframes) != 1 {
-		t.Errorf("Expected 1 keyframe, got %d", len(keyframes))
-	}
-}
-
-func TestDetectKeyframesIdenticalFrames(t *testing.T) {
-	tempDir := t.TempDir()
-
-	// Create 3 identical frames
-	var frames []Frame
-	for i := 1; i <= 3; i++ {
-		framePath := createTestImage(t, tempDir, "%04d.png", color.RGBA{255, 0, 0, 255})
-		frames = append(frames, Frame{
-			Path:      framePath,
-			Index:     i,
-			Timestamp: time.Duration(i-1) * time.Second,
-		})
-	}
-
-	keyframes, err := DetectKeyframes(frames, 0.85, nil)
-	if err != nil {
-		t.Fatalf("DetectKeyframes failed: %v", err)
-	}
-
-	// Should include first and last only (since they're identical)
-	if len(keyframes) != 2 {
-		t.Errorf("Expected 2 keyframes (first and last), got %d", len(keyframes))
-	}
-}
-
-func TestDetectKeyframesDifferentFrames(t *testing.T) {
-	tempDir := t.TempDir()
-
-	// Create frames with different colors
-	// Note: Solid color frames have zero variance, so NCC returns 1.0 (identical)
-	// This test verifies first and last frames are always included
-	colors := []color.RGBA{
-		{255, 0, 0, 255}, // Red
-		{0, 255, 0, 255}, // Green
-		{0, 0, 255, 255}, // Blue
-	}
-
-	frames := make([]Frame, 0, len(colors))
-	for i, c := range colors {
-		idx := i + 1
-		framePath := createTestImage(t, tempDir, "%04d.png", c)
-		frames = append(frames, Frame{
-			Path:      framePath,
-			Index:     idx,
-			Timestamp: time.Duration(i) * time.Second,
-		})
-	}
-
-	keyframes, err := DetectKeyframes(frames, 0.85, nil)
-	if err != nil {
-		t.Fatalf("DetectKeyframes failed: %v", err)
-	}
-
-	// First and last frames should always be included
-	if len(keyframes) < 2 {
-		t.Errorf("Expected at least 2 keyframes (first and last), got %d", len(keyframes))
+func TestParseCompareMode(t *testing.T) {
+	for _, name := range []string{"consecutive", "keyframe", "Both"} {
+		if _, err := ParseCompareMode(name); err != nil {
+			t.Errorf("ParseCompareMode(%q) failed: %v", name, err)
+		}
 	}
-
-	// Verify first frame is included
-	if keyframes[0].Index != 1 {
-		t.Errorf("Expected first keyframe to have index 1, got %d", keyframes[0].Index)
-	}
-
-	// Verify last frame is included
-	if keyframes[len(keyframes)-1].Index != 3 {
-		t.Errorf("Expected last keyframe to have index 3, got %d", keyframes[len(keyframes)-1].Index)
+	if _, err := ParseCompareMode("anchor"); err == nil {
+		t.Error("Expected error for unknown comparison mode")
 	}
 }
 
@@ -144,6 +57,56 @@ func TestNormalizedCrossCorrelation(t *testing.T) {
 	}
 }
 
+func TestComparisonDimensions(t *testing.T) {
+	tests := []struct {
+		width, height, longEdge int
+		wantW, wantH            int
+	}{
+		{1920, 1080, 400, 400, 225}, // Landscape screen recording
+		{1080, 1920, 400, 225, 400}, // Portrait phone video
+		{1000, 1000, 400, 400, 400}, // Square
+		{320, 240, 400, 320, 240},   // Smaller than the long edge: unchanged
+		{4000, 10, 400, 400, 1},     // Extreme aspect keeps at least one row
+		{0, 1080, 400, 0, 0},        // Unknown size
+	}
+
+	for _, tt := range tests {
+		w, h := ComparisonDimensions(tt.width, tt.height, tt.longEdge)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("ComparisonDimensions(%d, %d, %d) = %dx%d, want %dx%d",
+				tt.width, tt.height, tt.longEdge, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestFrameSize(t *testing.T) {
+	framePath := createTestImage(t, t.TempDir(), "0001.png", color.RGBA{255, 0, 0, 255})
+
+	width, height, err := FrameSize(framePath)
+	if err != nil {
+		t.Fatalf("FrameSize failed: %v", err)
+	}
+	if width != 100 || height != 100 {
+		t.Errorf("Expected 100x100, got %dx%d", width, height)
+	}
+
+	if _, _, err := FrameSize("/nonexistent/frame.png"); err == nil {
+		t.Error("Expected error for nonexistent frame")
+	}
+}
+
+func TestScaledSize(t *testing.T) {
+	w, h := ScaledSize(1920, 1080, 0.5)
+	if w != 960 || h != 540 {
+		t.Errorf("Expected 960x540, got %dx%d", w, h)
+	}
+
+	w, h = ScaledSize(1920, 1080, 1.0)
+	if w != 1920 || h != 1080 {
+		t.Errorf("Expected unscaled 1920x1080, got %dx%d", w, h)
+	}
+}
+
 func TestSaveKeyframes(t *testing.T) {
 	tempDir := t.TempDir()
 	outputDir := filepath.Join(tempDir, "output")
@@ -207,3 +170,88 @@ func createTestImage(t *testing.T, dir, _ string, c color.Color) string {
 
 	return file.Name()
 }
+
+func TestSelectKeyframes(t *testing.T) {
+	frames := make([]Frame, 5)
+	for i := range frames {
+		frames[i] = Frame{Index: i + 1, Timestamp: time.Duration(i) * time.Second}
+	}
+	scores := []float64{0, 0.99, 0.5, 0.95, 0.97}
+
+	keyframes := SelectKeyframes(frames, scores, 0.85)
+
+	// First frame, the change at index 3, and the last frame
+	expected := []int{1, 3, 5}
+	if len(keyframes) != len(expected) {
+		t.Fatalf("Expected %d keyframes, got %d", len(expected), len(keyframes))
+	}
+	for i, idx := range expected {
+		if keyframes[i].Index != idx {
+			t.Errorf("Keyframe %d: expected index %d, got %d", i, idx, keyframes[i].Index)
+		}
+	}
+	if keyframes[1].Similarity != 0.5 {
+		t.Errorf("Expected similarity 0.5 for the change, got %f", keyframes[1].Similarity)
+	}
+
+	// A stricter threshold picks up more changes from the same scores
+	if got := SelectKeyframes(frames, scores, 0.96); len(got) != 4 {
+		t.Errorf("Expected 4 keyframes at threshold 0.96, got %d", len(got))
+	}
+}
+
+// keyframeIndices returns the Index of each keyframe
+func keyframeIndices(keyframes []Keyframe) []int {
+	indices := make([]int, len(keyframes))
+	for i, kf := range keyframes {
+		indices[i] = kf.Index
+	}
+	return indices
+}
+
+func TestSelectKeyframesSpacing(t *testing.T) {
+	frames := make([]Frame, 12)
+	for i := range frames {
+		frames[i] = Frame{Index: i + 1, Timestamp: time.Duration(i) * time.Second}
+	}
+	// Scrolling from 1s to 3s, then nothing changes
+	scores := []float64{0, 0.5, 0.4, 0.6, 0.99, 0.99, 0.99, 0.99, 0.99, 0.99, 0.99, 0.99}
+
+	if got := keyframeIndices(SelectKeyframesWithOptions(frames, scores, SelectOptions{Threshold: 0.85})); !slices.Equal(got, []int{1, 2, 3, 4, 12}) {
+		t.Errorf("Expected every scroll frame without spacing, got %v", got)
+	}
+
+	// Changes within 2s of the last keyframe are deferred; frame 5 stands in
+	// for the change at frame 4 and carries its score
+	spaced := SelectKeyframesWithOptions(frames, scores, SelectOptions{Threshold: 0.85, MinInterval: 2 * time.Second})
+	if got := keyframeIndices(spaced); !slices.Equal(got, []int{1, 3, 5, 12}) {
+		t.Errorf("Expected a minimum 2s interval, got %v", got)
+	}
+	if spaced[2].Similarity != 0.6 {
+		t.Errorf("Expected deferred change to score 0.6, got %f", spaced[2].Similarity)
+	}
+
+	// The static stretch gets a frame every 3s
+	forced := SelectKeyframesWithOptions(frames, scores, SelectOptions{Threshold: 0.85, MaxInterval: 3 * time.Second})
+	if got := keyframeIndices(forced); !slices.Equal(got, []int{1, 2, 3, 4, 7, 10, 12}) {
+		t.Errorf("Expected a maximum 3s interval, got %v", got)
+	}
+}
+
+func TestSelectKeyframesCap(t *testing.T) {
+	frames := make([]Frame, 6)
+	for i := range frames {
+		frames[i] = Frame{Index: i + 1, Timestamp: time.Duration(i) * time.Second}
+	}
+	scores := []float64{0, 0.7, 0.2, 0.8, 0.5, 0.6}
+
+	// Keeps the first frame and the two lowest-scoring changes, in order
+	capped := SelectKeyframesWithOptions(frames, scores, SelectOptions{Threshold: 0.85, MaxKeyframes: 3})
+	if got := keyframeIndices(capped); !slices.Equal(got, []int{1, 3, 5}) {
+		t.Errorf("Expected frames 1, 3 and 5, got %v", got)
+	}
+
+	if got := SelectKeyframesWithOptions(frames, scores, SelectOptions{Threshold: 0.85, MaxKeyframes: 1}); len(got) != 1 || got[0].Index != 1 {
+		t.Errorf("Expected only the first frame, got %v", keyframeIndices(got))
+	}
+}
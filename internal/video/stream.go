@@ -0,0 +1,349 @@
+package video
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamFrames samples frames with the extraction options, piping them from
+// ffmpeg as raw RGB at comparison size, and scores them with a pool of
+// workers as they arrive. Each frame's score is its similarity with the
+// frame(s) selected by the comparison mode; with CompareBoth it is the lower
+// of the two. The first frame of each range scores 0. Frame timestamps are
+// the presentation timestamps reported by ffmpeg, relative to the first frame
+// of each range plus the range's start, so they match times in the original
+// input. Frames also record their Sharpness, PrevSimilarity and Hash, for
+// RefineKeyframes and DedupeKeyframes. Write the selected keyframes at full
+// resolution with ExtractKeyframeImages. srcWidth and srcHeight are the
+// input's display size, as from Probe.
+//
+// Except for CompareConsecutive, which frames become the reference depends
+// on the threshold, so the scores are only valid for detect.Threshold.
+func StreamFrames(inputPath string, srcWidth, srcHeight int, duration time.Duration, extract ExtractOptions, detect DetectOptions, onProgress ProgressFunc) ([]Frame, []float64, error) {
+	sampler, err := extract.samplerFilter()
+	if err != nil {
+		return nil, nil, err
+	}
+	if srcWidth <= 0 || srcHeight <= 0 {
+		return nil, nil, fmt.Errorf("unknown video size")
+	}
+
+	// Frames are read by size, so scale to exact dimensions
+	width, height := ComparisonDimensions(srcWidth, srcHeight, detect.comparisonSize())
+	filter := fmt.Sprintf("%s,showinfo,scale=%d:%d:flags=bilinear,format=rgb24", sampler, width, height)
+
+	clips := extract.clips()
+	var frames []Frame
+	var scores []float64
+	for k, clip := range clips {
+		clipFrames, clipScores, err := streamClip(inputPath, filter, clip, width, height, extract, detect,
+			clipProgress(onProgress, clips, k, duration), clip.Length(duration))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(clipFrames) == 0 && len(clips) > 1 {
+			return nil, nil, fmt.Errorf("no frames extracted from range %s", clip)
+		}
+
+		// Number frames across all ranges
+		for i := range clipFrames {
+			clipFrames[i].Index += len(frames)
+		}
+		frames = append(frames, clipFrames...)
+		scores = append(scores, clipScores...)
+	}
+
+	if len(scores) == 0 {
+		return nil, nil, fmt.Errorf("no frames extracted from video")
+	}
+
+	return frames, scores, nil
+}
+
+// streamClip samples and scores the frames of one range of the input
+func streamClip(inputPath, filter string, clip TimeRange, width, height int, extract ExtractOptions, detect DetectOptions, onProgress ProgressFunc, length time.Duration) ([]Frame, []float64, error) {
+	args := append(clip.seekArgs(),
+		"-i", inputPath,
+		"-vf", filter,
+		"-vsync", "vfr",
+		"-f", "rawvideo",
+		"-pix_fmt", "rgb24",
+		"-loglevel", "info", // showinfo logs at info level
+		"-progress", "pipe:2", // Progress shares stderr with showinfo
+		"-nostats",
+		"pipe:1",
+	)
+	cmd := exec.Command("ffmpeg", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	// Collect frame timestamps and progress from stderr
+	var info showinfoLog
+	infoDone := make(chan struct{})
+	go func() {
+		defer close(infoDone)
+		info = parseShowinfo(stderr, length, onProgress)
+	}()
+
+	frames, scores, readErr := scoreRawFrames(bufio.NewReader(stdout), width, height, detect, runtime.NumCPU())
+	if readErr != nil {
+		// Stop ffmpeg so it doesn't block writing frames nobody reads
+		_ = cmd.Process.Kill()
+	}
+	_, _ = io.Copy(io.Discard, stdout)
+	<-infoDone
+
+	if err := cmd.Wait(); err != nil && readErr == nil {
+		if info.lastError != "" {
+			return nil, nil, fmt.Errorf("ffmpeg extraction failed: %w: %s", err, info.lastError)
+		}
+		return nil, nil, fmt.Errorf("ffmpeg extraction failed: %w", err)
+	}
+	if readErr != nil {
+		return nil, nil, readErr
+	}
+
+	if err := assignTimestamps(frames, info.pts, extract, clip.Start); err != nil {
+		return nil, nil, err
+	}
+
+	return frames, scores, nil
+}
+
+// framePair is a frame to score against its predecessor
+type framePair struct {
+	index      int
+	prev, curr *Thumbnail
+}
+
+// pairScore is a framePair's similarity, computed by a worker
+type pairScore struct {
+	index     int
+	curr      *Thumbnail
+	score     float64
+	sharpness float64
+	hash      uint64
+}
+
+// scoreRawFrames reads packed 8-bit RGB frames of the given size until EOF
+// and scores them. Consecutive similarities, sharpness and hashes are
+// computed by a pool of workers; results are then put back in order for the
+// comparison mode, which may depend on earlier frames. The returned frames
+// have only Index, Sharpness, PrevSimilarity and Hash set.
+func scoreRawFrames(r io.Reader, width, height int, opts DetectOptions, workers int) ([]Frame, []float64, error) {
+	pairs := make(chan framePair, workers)
+	results := make(chan pairScore, workers)
+	metric := opts.metric()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pairs {
+				res := pairScore{
+					index:     p.index,
+					curr:      p.curr,
+					sharpness: sharpness(p.curr),
+					hash:      pHash(p.curr),
+				}
+				if p.prev != nil {
+					res.score = metric.Compare(p.prev, p.curr)
+				}
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Read frames and hand them to the workers
+	var readErr error
+	go func() {
+		defer close(pairs)
+		var prev *Thumbnail
+		for index := 0; ; index++ {
+			buf := make([]byte, 3*width*height)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr = fmt.Errorf("failed to read frame %d from ffmpeg: %w", index+1, err)
+				}
+				return
+			}
+
+			curr := opts.applyRegions(newThumbnail(width, height, buf))
+			pairs <- framePair{index: index, prev: prev, curr: curr}
+			prev = curr
+		}
+	}()
+
+	// Put results back in frame order for the comparison mode
+	var frames []Frame
+	var scores []float64
+	var sc *scorer
+	pending := make(map[int]pairScore)
+	for res := range results {
+		pending[res.index] = res
+		for {
+			next, ok := pending[len(scores)]
+			if !ok {
+				break
+			}
+			delete(pending, next.index)
+			frames = append(frames, Frame{
+				Index:          next.index + 1,
+				Sharpness:      next.sharpness,
+				PrevSimilarity: next.score,
+				Hash:           next.hash,
+			})
+			if sc == nil {
+				sc = newScorer(opts, next.curr)
+				scores = append(scores, 0)
+				continue
+			}
+			scores = append(scores, sc.score(next.score, next.curr))
+		}
+	}
+
+	// results is closed only after the reader has closed pairs
+	if readErr != nil {
+		return nil, nil, readErr
+	}
+	return frames, scores, nil
+}
+
+// ExtractKeyframeImages writes the sampled frames chosen as keyframes into
+// outputDir at full resolution and sets each keyframe's Path. The keyframes
+// must be in frame order and come from frames sampled with the same options,
+// for example by StreamFrames; frames tells which range each one is in.
+// Repeats marked by DedupeKeyframes are skipped.
+func ExtractKeyframeImages(inputPath, outputDir string, frames []Frame, keyframes []Keyframe, opts ExtractOptions, duration time.Duration, onProgress ProgressFunc) error {
+	sampler, err := opts.samplerFilter()
+	if err != nil {
+		return err
+	}
+
+	clips := opts.clips()
+	starts := clipStarts(frames, clips)
+
+	// Group the keyframes with their own image by range, as positions in
+	// that range's sampled frames
+	byClip := make([][]int, len(clips))
+	var originals []int
+	for i, kf := range keyframes {
+		if kf.DuplicateOf != 0 {
+			continue
+		}
+		pos := kf.Index - 1
+		k := sort.Search(len(clips), func(k int) bool { return starts[k+1] > pos })
+		if k == len(clips) {
+			return fmt.Errorf("keyframe %d is not among the %d sampled frames", kf.Index, len(frames))
+		}
+		byClip[k] = append(byClip[k], pos-starts[k])
+		originals = append(originals, i)
+	}
+	if len(originals) == 0 {
+		return nil
+	}
+
+	written := 0
+	for k, clip := range clips {
+		if len(byClip[k]) == 0 {
+			continue
+		}
+		err := extractClipImages(inputPath, outputDir, sampler, clip, byClip[k], written+1,
+			clip.Length(duration), clipProgress(onProgress, clips, k, duration))
+		if err != nil {
+			return err
+		}
+		written += len(byClip[k])
+	}
+
+	matches, err := filepath.Glob(filepath.Join(outputDir, "keyframe_*.png"))
+	if err != nil {
+		return fmt.Errorf("failed to read keyframes directory: %w", err)
+	}
+	if len(matches) != len(originals) {
+		return fmt.Errorf("expected %d keyframe images from ffmpeg, got %d", len(originals), len(matches))
+	}
+
+	// Output numbering follows the sampled frame order
+	sort.Strings(matches)
+	for i, k := range originals {
+		keyframes[k].Path = matches[i]
+	}
+
+	return nil
+}
+
+// extractClipImages writes the sampled frames at the given positions within
+// one range, numbering the images from first
+func extractClipImages(inputPath, outputDir, sampler string, clip TimeRange, positions []int, first int, length time.Duration, onProgress ProgressFunc) error {
+	// Pick the keyframes out of the sampled frames by their position
+	terms := make([]string, len(positions))
+	for i, pos := range positions {
+		terms[i] = fmt.Sprintf("eq(n\\,%d)", pos)
+	}
+	filter := fmt.Sprintf("%s,select='%s'", sampler, strings.Join(terms, "+"))
+
+	args := append(clip.seekArgs(),
+		"-i", inputPath,
+		"-vf", filter,
+		"-vsync", "vfr",
+		"-start_number", strconv.Itoa(first),
+		"-loglevel", "error",
+		"-progress", "pipe:1",
+		"-nostats",
+		filepath.Join(outputDir, "keyframe_%06d.png"),
+	)
+	cmd := exec.Command("ffmpeg", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	if onProgress != nil && length > 0 {
+		parseFFmpegProgress(stdout, length, onProgress)
+	}
+	_, _ = io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("ffmpeg keyframe extraction failed: %w: %s", err, msg)
+		}
+		return fmt.Errorf("ffmpeg keyframe extraction failed: %w", err)
+	}
+
+	return nil
+}
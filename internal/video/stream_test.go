@@ -0,0 +1,216 @@
+package video
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScoreRawFrames(t *testing.T) {
+	// A crossfade between a horizontal and a vertical gradient, as packed RGB
+	const size, count = 24, 15
+	var raw bytes.Buffer
+	thumbs := make([]*Thumbnail, count)
+	for i := range count {
+		alpha := float64(i) / float64(count-1)
+		rgb := make([]uint8, 0, 3*size*size)
+		for y := range size {
+			for x := range size {
+				v := byte(((1-alpha)*float64(x) + alpha*float64(y)) * 255 / size)
+				rgb = append(rgb, v, v/2, 255-v)
+			}
+		}
+		raw.Write(rgb)
+		thumbs[i] = newThumbnail(size, size, rgb)
+	}
+
+	for _, mode := range []CompareMode{CompareConsecutive, CompareKeyframe, CompareBoth} {
+		opts := DetectOptions{Threshold: 0.85, Compare: mode, Metric: SSIM{}}
+
+		// Expected scores from an in-order pass over the same frames
+		want := make([]float64, count)
+		sc := newScorer(opts, thumbs[0])
+		for i := 1; i < count; i++ {
+			want[i] = sc.score(SSIM{}.Compare(thumbs[i-1], thumbs[i]), thumbs[i])
+		}
+
+		for _, workers := range []int{1, 4} {
+			_, got, err := scoreRawFrames(bytes.NewReader(raw.Bytes()), size, size, opts, workers)
+			if err != nil {
+				t.Fatalf("%s/%d workers: scoreRawFrames failed: %v", mode, workers, err)
+			}
+			if len(got) != count {
+				t.Fatalf("%s/%d workers: expected %d scores, got %d", mode, workers, count, len(got))
+			}
+			for i := range want {
+				if math.Abs(got[i]-want[i]) > 1e-9 {
+					t.Errorf("%s/%d workers: score %d = %f, want %f", mode, workers, i, got[i], want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestScoreRawFramesTruncated(t *testing.T) {
+	// A partial trailing frame means ffmpeg output was cut off
+	raw := make([]byte, 2*300+50)
+	_, _, err := scoreRawFrames(bytes.NewReader(raw), 10, 10, DetectOptions{Compare: CompareConsecutive}, 2)
+	if err == nil {
+		t.Error("Expected error for truncated frame data")
+	}
+}
+
+// rawFrames packs count frames of size by size pixels as the raw RGB that
+// ffmpeg streams, drawing each pixel of frame i with pixel
+func rawFrames(count, size int, pixel func(i, x, y int) color.RGBA) []byte {
+	raw := make([]byte, 0, 3*size*size*count)
+	for i := range count {
+		for y := range size {
+			for x := range size {
+				c := pixel(i, x, y)
+				raw = append(raw, c.R, c.G, c.B)
+			}
+		}
+	}
+	return raw
+}
+
+// fadePixel draws a crossfade over count frames from a horizontal gradient
+// to a vertical one: each frame is nearly identical to the previous one, but
+// the end looks nothing like the start
+func fadePixel(count int) func(i, x, y int) color.RGBA {
+	return func(i, x, y int) color.RGBA {
+		alpha := float64(i) / float64(count-1)
+		v := uint8(((1-alpha)*float64(x) + alpha*float64(y)) * 2.55)
+		return color.RGBA{v, v, v, 255}
+	}
+}
+
+// detectRaw scores raw 100x100 frames and selects keyframes at the same
+// threshold
+func detectRaw(t *testing.T, raw []byte, opts DetectOptions) []Keyframe {
+	t.Helper()
+	frames, scores, err := scoreRawFrames(bytes.NewReader(raw), 100, 100, opts, 2)
+	if err != nil {
+		t.Fatalf("scoreRawFrames failed: %v", err)
+	}
+	return SelectKeyframes(frames, scores, opts.Threshold)
+}
+
+func TestScoreRawFramesEmpty(t *testing.T) {
+	keyframes := detectRaw(t, nil, DetectOptions{Threshold: 0.85})
+	if len(keyframes) != 0 {
+		t.Errorf("Expected empty keyframes, got %d", len(keyframes))
+	}
+}
+
+func TestScoreRawFramesSingleFrame(t *testing.T) {
+	raw := rawFrames(1, 100, func(_, _, _ int) color.RGBA { return color.RGBA{255, 0, 0, 255} })
+	if keyframes := detectRaw(t, raw, DetectOptions{Threshold: 0.85}); len(keyframes) != 1 {
+		t.Errorf("Expected 1 keyframe, got %d", len(keyframes))
+	}
+}
+
+func TestScoreRawFramesIdentical(t *testing.T) {
+	raw := rawFrames(3, 100, func(_, x, _ int) color.RGBA {
+		return color.RGBA{uint8(2 * x), 0, 0, 255}
+	})
+	keyframes := detectRaw(t, raw, DetectOptions{Threshold: 0.85})
+
+	// Should include first and last only (since they're identical)
+	if !slices.Equal(keyframeIndices(keyframes), []int{1, 3}) {
+		t.Errorf("Expected keyframes 1 and 3 (first and last), got %v", keyframeIndices(keyframes))
+	}
+}
+
+func TestScoreRawFramesSolidColors(t *testing.T) {
+	// Solid color frames have zero variance, so NCC returns 1.0 (identical).
+	// First and last frames are still always included.
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+	raw := rawFrames(len(colors), 100, func(i, _, _ int) color.RGBA { return colors[i] })
+	keyframes := detectRaw(t, raw, DetectOptions{Threshold: 0.85})
+
+	if !slices.Equal(keyframeIndices(keyframes), []int{1, 3}) {
+		t.Errorf("Expected keyframes 1 and 3 (first and last), got %v", keyframeIndices(keyframes))
+	}
+}
+
+func TestScoreRawFramesGradualFade(t *testing.T) {
+	raw := rawFrames(20, 100, fadePixel(20))
+
+	consecutive := detectRaw(t, raw, DetectOptions{Threshold: 0.85, Compare: CompareConsecutive})
+	if len(consecutive) != 2 {
+		t.Errorf("Expected consecutive comparison to miss the fade (first and last only), got %d keyframes", len(consecutive))
+	}
+
+	anchored := detectRaw(t, raw, DetectOptions{Threshold: 0.85, Compare: CompareKeyframe})
+	if len(anchored) < 3 {
+		t.Fatalf("Expected keyframe comparison to catch the fade, got %d keyframes", len(anchored))
+	}
+	for _, kf := range anchored[1 : len(anchored)-1] {
+		if kf.Similarity >= 0.85 {
+			t.Errorf("Keyframe %d has similarity %f, expected below threshold", kf.Index, kf.Similarity)
+		}
+	}
+
+	both := detectRaw(t, raw, DetectOptions{Threshold: 0.85, Compare: CompareBoth})
+	if len(both) != len(anchored) {
+		t.Errorf("Expected both to match keyframe comparison on a smooth fade, got %d vs %d", len(both), len(anchored))
+	}
+}
+
+func TestStreamFramesUnknownSize(t *testing.T) {
+	extract := ExtractOptions{Sampler: SamplerFPS, FPS: 1}
+	_, _, err := StreamFrames("video.mp4", 0, 0, time.Second, extract, DetectOptions{Threshold: 0.85}, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown video size") {
+		t.Errorf("Expected an error for an unknown size, got %v", err)
+	}
+}
+
+func TestStreamFrames(t *testing.T) {
+	// Skip if ffmpeg is not available
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not found, skipping test")
+	}
+
+	testVideo := createTestVideo(t)
+	defer func() { _ = os.Remove(testVideo) }()
+
+	info, err := Probe(testVideo)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	width, height := info.Video.DisplaySize()
+
+	extract := ExtractOptions{Sampler: SamplerFPS, FPS: 4}
+	frames, scores, err := StreamFrames(testVideo, width, height, time.Second, extract, DetectOptions{Threshold: 0.85}, nil)
+	if err != nil {
+		t.Fatalf("StreamFrames failed: %v", err)
+	}
+	if len(frames) < 2 || len(scores) != len(frames) {
+		t.Fatalf("Expected several scored frames, got %d frames and %d scores", len(frames), len(scores))
+	}
+	if frames[1].Timestamp != 250*time.Millisecond {
+		t.Errorf("Expected second frame at 250ms, got %v", frames[1].Timestamp)
+	}
+
+	keyframes := SelectKeyframes(frames, scores, 0.85)
+	if err := ExtractKeyframeImages(testVideo, t.TempDir(), frames, keyframes, extract, time.Second, nil); err != nil {
+		t.Fatalf("ExtractKeyframeImages failed: %v", err)
+	}
+	for _, kf := range keyframes {
+		width, height, err := FrameSize(kf.Path)
+		if err != nil {
+			t.Fatalf("Keyframe %d image unreadable: %v", kf.Index, err)
+		}
+		if width != 320 || height != 240 {
+			t.Errorf("Expected full-resolution 320x240 keyframe, got %dx%d", width, height)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package video
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeRange is a span of the input, in time from its start
+type TimeRange struct {
+	Start time.Duration
+	// End is exclusive; 0 means the end of the input
+	End time.Duration
+}
+
+// ParseTimestamp parses a time in the input as seconds ("90", "12.5"),
+// M:SS ("12:30") or H:MM:SS ("1:02:03.5")
+func ParseTimestamp(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q: expected seconds, M:SS or H:MM:SS", s)
+	}
+
+	var total float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q: expected seconds, M:SS or H:MM:SS", s)
+		}
+		// Only the first field may exceed a minute's worth
+		if i > 0 && v >= 60 {
+			return 0, fmt.Errorf("invalid timestamp %q: minutes and seconds must be below 60", s)
+		}
+		total = total*60 + v
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
+
+// ParseTimeRange parses "start-end", such as "12:00-18:00". Either side may
+// be left empty to mean the start or end of the input.
+func ParseTimeRange(s string) (TimeRange, error) {
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return TimeRange{}, fmt.Errorf("invalid range %q: expected start-end", s)
+	}
+
+	var r TimeRange
+	var err error
+	if strings.TrimSpace(startStr) != "" {
+		if r.Start, err = ParseTimestamp(startStr); err != nil {
+			return TimeRange{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+	}
+	if strings.TrimSpace(endStr) != "" {
+		if r.End, err = ParseTimestamp(endStr); err != nil {
+			return TimeRange{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		if r.End <= r.Start {
+			return TimeRange{}, fmt.Errorf("invalid range %q: end must be after start", s)
+		}
+	}
+	return r, nil
+}
+
+// MergeRanges sorts ranges by start and merges those that overlap or touch
+func MergeRanges(ranges []TimeRange) []TimeRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sorted := append([]TimeRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	merged := []TimeRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if last.End != 0 && r.Start > last.End {
+			merged = append(merged, r)
+			continue
+		}
+		if last.End != 0 && (r.End == 0 || r.End > last.End) {
+			last.End = r.End
+		}
+	}
+	return merged
+}
+
+// Length returns how long the range is, given the input's duration. It is
+// 0 if the range is open-ended and the duration unknown.
+func (r TimeRange) Length(duration time.Duration) time.Duration {
+	end := r.End
+	if end == 0 || (duration > 0 && end > duration) {
+		end = duration
+	}
+	return max(0, end-r.Start)
+}
+
+// String formats the range in seconds, such as "720s-1080s"
+func (r TimeRange) String() string {
+	if r.End == 0 {
+		return formatSeconds(r.Start) + "s-end"
+	}
+	return formatSeconds(r.Start) + "s-" + formatSeconds(r.End) + "s"
+}
+
+// seekArgs returns the ffmpeg input options that limit decoding to the range
+func (r TimeRange) seekArgs() []string {
+	var args []string
+	if r.Start > 0 {
+		args = append(args, "-ss", formatSeconds(r.Start))
+	}
+	if r.End > 0 {
+		args = append(args, "-t", formatSeconds(r.End-r.Start))
+	}
+	return args
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// clips returns the ranges to sample: opts.Ranges, or the whole input
+func (o ExtractOptions) clips() []TimeRange {
+	if len(o.Ranges) == 0 {
+		return []TimeRange{{}}
+	}
+	return o.Ranges
+}
+
+// clipProgress maps progress within clip k onto progress across all clips,
+// weighting each clip by its length
+func clipProgress(onProgress ProgressFunc, clips []TimeRange, k int, duration time.Duration) ProgressFunc {
+	if onProgress == nil {
+		return nil
+	}
+
+	var total, before time.Duration
+	for i, c := range clips {
+		if i < k {
+			before += c.Length(duration)
+		}
+		total += c.Length(duration)
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	share := float64(clips[k].Length(duration)) / float64(total)
+	offset := float64(before) / float64(total)
+	return func(p float64) { onProgress(offset + p*share) }
+}
+
+// clipStarts returns the position in frames of the first frame of each clip,
+// plus len(frames) at the end, so clip k's frames are starts[k] up to
+// starts[k+1]. Frames are assigned to the last clip starting at or before their
+// timestamp, which holds because clips don't overlap.
+func clipStarts(frames []Frame, clips []TimeRange) []int {
+	starts := make([]int, len(clips)+1)
+	k := 0
+	for i, f := range frames {
+		for k < len(clips)-1 && f.Timestamp >= clips[k+1].Start {
+			k++
+			starts[k] = i
+		}
+	}
+	for k++; k <= len(clips); k++ {
+		starts[k] = len(frames)
+	}
+	return starts
+}
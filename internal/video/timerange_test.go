@@ -0,0 +1,120 @@
+package video
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"90", 90 * time.Second},
+		{"12.5", 12500 * time.Millisecond},
+		{"12:30", 12*time.Minute + 30*time.Second},
+		{"1:02:03.5", time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		{"90:00", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.input)
+		if err != nil {
+			t.Errorf("ParseTimestamp(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimestamp(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "abc", "-5", "1:60", "1:2:3:4"} {
+		if _, err := ParseTimestamp(input); err == nil {
+			t.Errorf("Expected error for timestamp %q", input)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	r, err := ParseTimeRange("12:00-18:00")
+	if err != nil {
+		t.Fatalf("ParseTimeRange failed: %v", err)
+	}
+	if r != (TimeRange{Start: 12 * time.Minute, End: 18 * time.Minute}) {
+		t.Errorf("Unexpected range: %+v", r)
+	}
+
+	if r, err := ParseTimeRange("45:00-"); err != nil || r != (TimeRange{Start: 45 * time.Minute}) {
+		t.Errorf("Expected open-ended range from 45:00, got %+v (%v)", r, err)
+	}
+	if r, err := ParseTimeRange("-30"); err != nil || r != (TimeRange{End: 30 * time.Second}) {
+		t.Errorf("Expected range up to 30s, got %+v (%v)", r, err)
+	}
+
+	for _, input := range []string{"12:00", "18:00-12:00", "5-5", "a-b"} {
+		if _, err := ParseTimeRange(input); err == nil {
+			t.Errorf("Expected error for range %q", input)
+		}
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	m := time.Minute
+	merged := MergeRanges([]TimeRange{
+		{Start: 40 * m, End: 50 * m},
+		{Start: 10 * m, End: 20 * m},
+		{Start: 15 * m, End: 25 * m},
+		{Start: 25 * m, End: 30 * m},
+		{Start: 60 * m},
+		{Start: 70 * m, End: 80 * m},
+	})
+	want := []TimeRange{{Start: 10 * m, End: 30 * m}, {Start: 40 * m, End: 50 * m}, {Start: 60 * m}}
+	if !slices.Equal(merged, want) {
+		t.Errorf("MergeRanges = %+v, want %+v", merged, want)
+	}
+
+	if MergeRanges(nil) != nil {
+		t.Error("Expected nil for no ranges")
+	}
+}
+
+func TestTimeRangeSeekArgs(t *testing.T) {
+	r := TimeRange{Start: 90 * time.Second, End: 150500 * time.Millisecond}
+	if got := r.seekArgs(); !slices.Equal(got, []string{"-ss", "90", "-t", "60.5"}) {
+		t.Errorf("Unexpected seek args: %v", got)
+	}
+	if got := (TimeRange{}).seekArgs(); len(got) != 0 {
+		t.Errorf("Expected no seek args for the whole input, got %v", got)
+	}
+	if got := (TimeRange{Start: 30 * time.Second}).Length(time.Minute); got != 30*time.Second {
+		t.Errorf("Expected open-ended range to run to the end, got %v", got)
+	}
+}
+
+func TestClipStarts(t *testing.T) {
+	clips := []TimeRange{
+		{Start: 10 * time.Second, End: 13 * time.Second},
+		{Start: 20 * time.Second, End: 21 * time.Second},
+		{Start: 60 * time.Second},
+	}
+	frames := []Frame{
+		{Timestamp: 10 * time.Second}, {Timestamp: 11 * time.Second}, {Timestamp: 12 * time.Second},
+		{Timestamp: 60 * time.Second}, {Timestamp: 61 * time.Second},
+	}
+
+	// The middle range produced no frames
+	if got := clipStarts(frames, clips); !slices.Equal(got, []int{0, 3, 3, 5}) {
+		t.Errorf("clipStarts = %v, want [0 3 3 5]", got)
+	}
+}
+
+func TestClipProgress(t *testing.T) {
+	clips := []TimeRange{{Start: 0, End: 10 * time.Second}, {Start: 50 * time.Second, End: 80 * time.Second}}
+	var got float64
+	progress := clipProgress(func(p float64) { got = p }, clips, 1, 100*time.Second)
+
+	progress(0.5)
+	if want := 0.25 + 0.5*0.75; got != want {
+		t.Errorf("Expected overall progress %f, got %f", want, got)
+	}
+}